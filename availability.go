@@ -2,20 +2,26 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"math/rand"
+	"strings"
 	"sync"
 	"time"
 
-	pc "github.com/brensch/proxy/client"
-
 	"go.uber.org/zap"
 )
 
 const retryLimit = 3
 
+// The states a campsite can be in on a date. Providers that use other names map onto these.
+const (
+	StateAvailable     = "Available"
+	StateReserved      = "Reserved"
+	StateNotReservable = "Not Reservable"
+	StateClosed        = "Closed"
+	// StateNotYetReleased is a date that can't be booked yet because it's outside the booking window
+	StateNotYetReleased = "NYR"
+)
+
 type Availability struct {
 	Campsites map[string]Campsite `json:"campsites,omitempty"`
 	Count     int                 `json:"count,omitempty"`
@@ -23,6 +29,8 @@ type Availability struct {
 
 type AvailabilityWithID struct {
 	CampgroundID string
+	// Provider is the name of the provider the availability came from. Empty means the default provider.
+	Provider     string
 	Availability Availability
 }
 
@@ -43,204 +51,195 @@ type Campsite struct {
 	// TODO: find example of this. haven't seen what form it takes yet.
 	CampsiteRules interface{} `json:"campsite_rules"`
 
+	// Details come from the CampsiteCatalog rather than the provider's availability, nil if we don't have them
+	Details *CampsiteDetails `json:"details,omitempty"`
+
 	// not sure what quantities means
 	// TODO: figure out if we need it
 	Quantities struct{} `json:"quantities"`
 }
 
+// Fits is whether a party of partySize is allowed at the campsite. Zero means we don't know the party size or
+// the campsite's limit, so anything fits.
+func (c Campsite) Fits(partySize int) bool {
+	if partySize <= 0 {
+		return true
+	}
+	if c.MinNumPeople > 0 && partySize < c.MinNumPeople {
+		return false
+	}
+	if c.MaxNumPeople > 0 && partySize > c.MaxNumPeople {
+		return false
+	}
+	return true
+}
+
 func GetStartOfMonth(input time.Time) time.Time {
 	return time.Date(input.Year(), input.Month(), 1, 0, 0, 0, 0, time.UTC)
 }
 
-// GetAvailability ensures that the targettime is snapped to the start of the month, then queries the API for all availabilities at that ground
-func GetAvailability(ctx context.Context, olog *zap.Logger, client *pc.Client, campgroundID string, targetTime time.Time) (AvailabilityWithID, error) {
-	start := time.Now()
-	log := olog.With(
-		zap.String("campground", campgroundID),
-		zap.Time("target_time", targetTime),
-	)
-	log.Debug("getting availability from api")
-	endpoint := fmt.Sprintf("https://www.recreation.gov/api/camps/availability/campground/%s/month", campgroundID)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		log.Error("couldn't create request", zap.Error(err))
-		return AvailabilityWithID{}, err
+// CampsitesFromAvailability strips the availabilities from the campsites, leaving just what we know about them
+func CampsitesFromAvailability(availability Availability) map[string]Campsite {
+	campsites := make(map[string]Campsite, len(availability.Campsites))
+	for campsiteID, campsite := range availability.Campsites {
+		campsite.Availabilities = nil
+		campsites[campsiteID] = campsite
 	}
+	return campsites
+}
 
-	// round the time to the start of the target month and put in param "start_date"
-	monthStart := GetStartOfMonth(targetTime)
-
-	// params need to be url encoded. ie base64
-	v := req.URL.Query()
-	v.Add("start_date", monthStart.Format("2006-01-02T15:04:05.000Z"))
-	req.URL.RawQuery = v.Encode()
-
-	retries := 0
-	var availability Availability
-
-	for {
-		if retries >= retryLimit {
-			return AvailabilityWithID{}, err
-		}
-		if retries > 0 {
-			log.Debug("retrying request", zap.Int("retries", retries))
-			time.Sleep(time.Duration(retries) * time.Second)
-		}
-
-		res, err := client.Do(req, log)
-		if err != nil {
-			log.Error("couldn't do request", zap.Error(err))
-			retries++
-			continue
-		}
-		defer res.Body.Close()
+// ParseCampsiteList splits a comma separated list of campsite IDs, dropping any blanks
+func ParseCampsiteList(input string) []string {
+	return ParseCommaList(input)
+}
 
-		resContents, err := io.ReadAll(res.Body)
-		if err != nil {
-			log.Error("couldn't read response", zap.Error(err))
-			retries++
+// ParseCommaList splits a comma separated list, trimming whitespace and dropping empty entries
+func ParseCommaList(input string) []string {
+	var values []string
+	for _, value := range strings.Split(input, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
 			continue
 		}
+		values = append(values, value)
+	}
+	return values
+}
 
-		if res.StatusCode != http.StatusOK {
-			log.Warn("got bad statuscode getting availability", zap.Int("status_code", res.StatusCode))
-			log.Debug("body of bad request", zap.String("body", string(resContents)))
-			err = fmt.Errorf("Got bad status code: %d", res.StatusCode)
-			retries++
-			continue
-			// Leaving this as just a warning so that logs don't count as errors until they fail the retry
-		}
-		err = json.Unmarshal(resContents, &availability)
-		if err != nil {
-			log.Error("couldn't unmarshal", zap.Error(err))
-			retries++
-			continue
+// FindUnknownCampsites returns the campsite IDs that aren't one of the campground's campsites
+func FindUnknownCampsites(campsites map[string]Campsite, campsiteIDs []string) []string {
+	var unknown []string
+	for _, campsiteID := range campsiteIDs {
+		if _, ok := campsites[campsiteID]; !ok {
+			unknown = append(unknown, campsiteID)
 		}
-
-		break
 	}
-
-	log.Debug("completed getting availability from api", zap.Duration("duration", time.Since(start)))
-
-	return AvailabilityWithID{Availability: availability, CampgroundID: campgroundID}, nil
-
+	return unknown
 }
 
 type AvailabilityRequest struct {
+	Provider     string    `json:"provider"`
 	CampgroundID string    `json:"campground_id"`
 	TargetTime   time.Time `json:"target_time"` // this should be the start of the month
 }
 
-// ConstructAvailabilityRequests takes a list of schniffs and returns a list of availability requests by
-// de-duplicating the campgroundIDs and extracting all the time periods from the schniffs
-func ConstructAvailabilityRequests(ctx context.Context, olog *zap.Logger, client *http.Client, sc *SchniffCollection, t *tracker, now time.Time) []AvailabilityRequest {
-	campgroundTimes := make(map[string][]time.Time)
+// AvailabilityResult is the outcome of a single availability request. Err is set if the request failed.
+type AvailabilityResult struct {
+	Request      AvailabilityRequest
+	Availability AvailabilityWithID
+	Err          error
+}
 
-	sc.mutex.Lock()
-	defer sc.mutex.Unlock()
+// FetchConfig controls how hard we hit the providers each cycle
+type FetchConfig struct {
+	// Concurrency is the most requests that can be in flight at once
+	Concurrency int
+	// Spread is how long the requests in a cycle are spread out over. Each request gets its own slot with
+	// some jitter, so they don't all land at once.
+	Spread time.Duration
+}
 
-	// Iterate over schniffs to extract the months the schniff ranges over for each campgroundID
-	for _, schniff := range sc.schniffs {
-		if !schniff.Active {
-			continue
-		}
+// DoRequests does a list of requests, sending each to its provider from a bounded pool of workers. Every
+// request gets a result, so one broken campground doesn't stop the rest from being checked.
+func DoRequests(ctx context.Context, olog *zap.Logger, providers ProviderRegistry, requests []AvailabilityRequest, config FetchConfig, t *tracker) []AvailabilityResult {
+	results := make([]AvailabilityResult, len(requests))
+	for i, request := range requests {
+		results[i].Request = request
+	}
 
-		// track active schniffs and users
-		t.AddActiveSchniff(schniff.SchniffID)
-		t.AddActiveUser(schniff.UserNick)
-		t.AddActiveCampground(schniff.CampgroundName)
-		currentDate := schniff.StartDate
-		for currentDate.Before(schniff.EndDate) || currentDate.Equal(schniff.EndDate) {
-			t.AddActiveDay(currentDate)
-			currentDate = currentDate.AddDate(0, 0, 1)
-		}
+	concurrency := config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-		// Generate all months between StartDate and EndDate
-		start, end := schniff.StartDate, schniff.EndDate
-		for d := start; d.Before(end) || d.Equal(end); d = d.AddDate(0, 1, 0) {
-			// skip if date is before now
-			if d.Before(now) {
-				continue
+	jobs := make(chan int, len(requests))
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// whatever is still in the channel is waiting on a free worker
+				t.RecordQueueDepth(len(jobs))
+				results[i].Availability, results[i].Err = doRequest(ctx, olog, providers, requests[i])
 			}
-
-			monthStart := time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC) // Start of the month
-			campgroundTimes[schniff.CampgroundID] = append(campgroundTimes[schniff.CampgroundID], monthStart)
-		}
+		}()
 	}
 
-	availabilityRequests := make([]AvailabilityRequest, 0)
-
-	// Create availability requests for each campgroundID and targetTime
-	for campgroundID, times := range campgroundTimes {
-		for _, targetTime := range times {
-			availabilityRequests = append(availabilityRequests, AvailabilityRequest{
-				CampgroundID: campgroundID,
-				TargetTime:   targetTime,
-			})
+	start := time.Now()
+	offsets := spreadOffsets(len(requests), config.Spread, rand.New(rand.NewSource(start.UnixNano())))
+	for i := range requests {
+		wait := time.Until(start.Add(offsets[i]))
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
 		}
+		if ctx.Err() != nil {
+			// anything not sent yet won't be done this cycle
+			for ; i < len(requests); i++ {
+				results[i].Err = ctx.Err()
+			}
+			break
+		}
+
+		jobs <- i
 	}
+	close(jobs)
 
-	return availabilityRequests
+	wg.Wait()
+
+	return results
 }
 
-func DeduplicateAvailabilityRequests(requests []AvailabilityRequest) []AvailabilityRequest {
-	seen := make(map[string]struct{})
-	var deduplicated []AvailabilityRequest
+func doRequest(ctx context.Context, olog *zap.Logger, providers ProviderRegistry, request AvailabilityRequest) (AvailabilityWithID, error) {
+	provider, err := providers.Get(request.Provider)
+	if err != nil {
+		olog.Error("Unable to find provider", zap.Error(err))
+		return AvailabilityWithID{}, err
+	}
 
-	for _, request := range requests {
-		key := request.CampgroundID + request.TargetTime.String()
-		if _, ok := seen[key]; !ok {
-			seen[key] = struct{}{}
-			deduplicated = append(deduplicated, request)
-		}
+	availability, err := provider.GetAvailability(ctx, olog, request.CampgroundID, request.TargetTime)
+	if err != nil {
+		olog.Error("Unable to get availability",
+			zap.String("provider", providerOrDefault(request.Provider)),
+			zap.String("campground", request.CampgroundID),
+			zap.Error(err),
+		)
+		return AvailabilityWithID{}, err
 	}
 
-	return deduplicated
+	return availability, nil
 }
 
-// CheckAvailability does a list of requests and returns a list of availabilities
-func DoRequests(ctx context.Context, olog *zap.Logger, client *pc.Client, requests []AvailabilityRequest) ([]AvailabilityWithID, error) {
-	var availabilities []AvailabilityWithID
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-	ctx, cancel := context.WithCancel(ctx)
-	var firstError error
-	var seenError bool
-	defer cancel()
-
-	for _, request := range requests {
-		wg.Add(1)
-		go func(request AvailabilityRequest) {
-			defer wg.Done()
-			// Use the current time as the targetTime
-			availability, err := GetAvailability(ctx, olog, client, request.CampgroundID, request.TargetTime)
-			if err != nil {
-				olog.Error("Unable to get availability", zap.Error(err))
-				mu.Lock()
-				// only want the first error seen returned.
-				// will get a slew of context cancelled errors after the first one
-				if !seenError {
-					firstError = err
-					seenError = true
-				}
-				mu.Unlock()
-				cancel()
-				return
-			}
-			mu.Lock()
-			availabilities = append(availabilities, availability)
-			mu.Unlock()
-		}(request)
+// spreadOffsets gives each of n requests a start offset within spread. Each request gets an equal slot and
+// a random point within it, so requests are evenly spread but never on a fixed beat.
+func spreadOffsets(n int, spread time.Duration, r *rand.Rand) []time.Duration {
+	offsets := make([]time.Duration, n)
+	if n == 0 || spread <= 0 {
+		return offsets
 	}
 
-	wg.Wait()
+	slot := spread / time.Duration(n)
+	for i := range offsets {
+		offsets[i] = time.Duration(i) * slot
+		if slot > 0 {
+			offsets[i] += time.Duration(r.Int63n(int64(slot)))
+		}
+	}
 
-	return availabilities, firstError
+	return offsets
 }
 
-// GenerateNotifications takes a list of schniffs and a list of availabilities and generates notifications
-func GenerateNotifications(ctx context.Context, olog *zap.Logger, availabilities []AvailabilityWithID, sc *SchniffCollection, notificationRecords []NotificationRecord) ([]Notification, []NotificationRecord, error) {
+// GenerateNotifications takes a list of schniffs and a list of availabilities and generates notifications.
+// Available nights are grouped into consecutive runs per campsite, and only runs at least as long as the
+// schniff's MinimumConsecutiveDays are notified. Flexible schniffs with a StayLength get every stay of that
+// length in the runs instead. Once a schniff has been checked against everything that's open, a run or stay is
+// only notified if one of its nights just opened up.
+func GenerateNotifications(ctx context.Context, olog *zap.Logger, availabilities []AvailabilityWithID, sc *SchniffCollection, rs *NotificationRecordStore, ct *ChangeTracker) ([]Notification, []NotificationRecord, error) {
 	var notifications []Notification
 	var newNotificationRecords []NotificationRecord
 	sc.mutex.Lock()
@@ -250,17 +249,48 @@ func GenerateNotifications(ctx context.Context, olog *zap.Logger, availabilities
 		if !schniff.Active {
 			continue
 		}
-		notification := Notification{SchniffID: schniff.SchniffID}
-		// Find the availability for this schniff
+
+		// an empty list means we're watching every campsite
+		campsiteIDs := make(map[string]struct{})
+		for _, campsiteID := range schniff.CampsiteIDs {
+			campsiteIDs[campsiteID] = struct{}{}
+		}
+
+		minimumNights := schniff.MinimumNights()
+
+		primed := ct.Primed(schniff)
+		seenCampground := false
+		// a schniff that filters on details can't have seen what's open until the catalog has the campground,
+		// otherwise the sites that were already open when the details arrived would never be notified
+		seenDetails := !schniff.FiltersOnDetails()
+
+		// Gather every available date in range across all the months we have for this campground so that
+		// runs straddling the end of a month are kept whole
+		var availableCampsites []CampsiteAvailability
+		campsites := make(map[string]Campsite)
 		for _, availability := range availabilities {
 			// Check if the schniff campgroundID matches the availability campgroundID
-			if schniff.CampgroundID != availability.CampgroundID {
+			if schniff.CampgroundID != availability.CampgroundID || schniff.ProviderName() != providerOrDefault(availability.Provider) {
 				continue
 			}
+			seenCampground = true
 
 			for campsiteID, campsite := range availability.Availability.Campsites {
+				if campsite.Details != nil {
+					seenDetails = true
+				}
+				if len(campsiteIDs) > 0 {
+					if _, ok := campsiteIDs[campsiteID]; !ok {
+						continue
+					}
+				}
+				if !schniff.Wants(campsite) {
+					continue
+				}
+				campsites[campsiteID] = campsite
+
 				for date, state := range campsite.Availabilities {
-					if state != "Available" {
+					if state != StateAvailable {
 						continue
 					}
 
@@ -274,35 +304,111 @@ func GenerateNotifications(ctx context.Context, olog *zap.Logger, availabilities
 						continue
 					}
 
-					// check if we've already notified of this availability for this schniff
-					alreadyNotified := false
-					for _, record := range notificationRecords {
-						if record.SchniffID == schniff.SchniffID &&
-							record.CampgroundID == availability.CampgroundID &&
-							record.TargetDate.Equal(date) {
-							alreadyNotified = true
-							break
-						}
-					}
-					if alreadyNotified {
-						continue
-					}
-
-					newNotificationRecords = append(newNotificationRecords, NotificationRecord{
-						SchniffID:    schniff.SchniffID,
-						CampgroundID: availability.CampgroundID,
-						CampsiteID:   campsiteID,
-						TargetDate:   date,
-						NotifiedAt:   time.Now(),
-					})
-
-					notification.AvailableCampsites = append(notification.AvailableCampsites, CampsiteAvailability{
+					availableCampsites = append(availableCampsites, CampsiteAvailability{
 						CampsiteID: campsiteID,
 						Date:       date,
 					})
+				}
+			}
+		}
 
+		// newNights finds the nights at the campsite that we haven't already told them about, and whether any of
+		// those has just opened up
+		newNights := func(campsiteID string, from, to time.Time) ([]time.Time, bool) {
+			var newDates []time.Time
+			changed := false
+			for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+				if rs.HasBeenNotified(schniff.SchniffID, schniff.CampgroundID, campsiteID, date) {
+					continue
 				}
+				newDates = append(newDates, date)
+				if !primed || ct.Opened(schniff.ProviderName(), schniff.CampgroundID, campsiteID, date) {
+					changed = true
+				}
+			}
+			return newDates, changed
+		}
+
+		notification := Notification{SchniffID: schniff.SchniffID}
+		// flexible stays overlap, so nights are only added to the notification and records once
+		addedNights := make(map[string]struct{})
+		addNight := func(campsiteID string, date time.Time) {
+			key := campsiteID + "/" + date.Format("2006-01-02")
+			if _, ok := addedNights[key]; ok {
+				return
+			}
+			addedNights[key] = struct{}{}
+			notification.AvailableCampsites = append(notification.AvailableCampsites, CampsiteAvailability{
+				CampsiteID:   campsiteID,
+				Date:         date,
+				Site:         campsites[campsiteID].Site,
+				CampsiteType: campsites[campsiteID].CampsiteType,
+				MinNumPeople: campsites[campsiteID].MinNumPeople,
+				MaxNumPeople: campsites[campsiteID].MaxNumPeople,
+				Loop:         campsites[campsiteID].Loop,
+				Details:      campsites[campsiteID].Details,
+			})
+		}
+		addedRecords := make(map[string]struct{})
+		addRecord := func(campsiteID string, date time.Time) {
+			key := campsiteID + "/" + date.Format("2006-01-02")
+			if _, ok := addedRecords[key]; ok {
+				return
 			}
+			addedRecords[key] = struct{}{}
+			newNotificationRecords = append(newNotificationRecords, NotificationRecord{
+				SchniffID:    schniff.SchniffID,
+				CampgroundID: schniff.CampgroundID,
+				CampsiteID:   campsiteID,
+				TargetDate:   date,
+				NotifiedAt:   time.Now(),
+			})
+		}
+
+		for _, run := range FindConsecutiveRuns(availableCampsites) {
+			// flexible schniffs want every stay of the right length that has something new in it
+			if schniff.StayLength > 0 {
+				for _, stay := range run.Stays(schniff.CheckInDays, int(schniff.StayLength)) {
+					lastNight := stay.CheckOut.AddDate(0, 0, -1)
+					newDates, changed := newNights(stay.CampsiteID, stay.CheckIn, lastNight)
+					if !changed {
+						continue
+					}
+					notification.Stays = append(notification.Stays, stay)
+					for _, date := range newDates {
+						addRecord(stay.CampsiteID, date)
+					}
+					for date := stay.CheckIn; !date.After(lastNight); date = date.AddDate(0, 0, 1) {
+						addNight(stay.CampsiteID, date)
+					}
+				}
+				continue
+			}
+
+			// only the part of the run that can be booked from an allowed check-in day is any use
+			run, ok := run.FromCheckIn(schniff.CheckInDays, minimumNights)
+			if !ok {
+				continue
+			}
+
+			// only notify about a run if it contains at least one night we haven't already told them about
+			// that has just opened up
+			newDates, changed := newNights(run.CampsiteID, run.Start, run.End)
+			if !changed {
+				continue
+			}
+
+			for _, date := range newDates {
+				addRecord(run.CampsiteID, date)
+			}
+			// include the whole run so the user sees the full stay that is on offer
+			for date := run.Start; !date.After(run.End); date = date.AddDate(0, 0, 1) {
+				addNight(run.CampsiteID, date)
+			}
+		}
+
+		if seenCampground && seenDetails {
+			ct.Prime(schniff)
 		}
 
 		if len(notification.AvailableCampsites) == 0 {
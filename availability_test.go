@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"sync"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"go.uber.org/zap"
 )
 
@@ -16,13 +18,15 @@ func TestGenerateNotifications(t *testing.T) {
 	ctx := context.Background()
 	logger, _ := zap.NewDevelopment()
 
-	// sc := NewSchniffCollection("example_schniffs.json")
-	sc := &SchniffCollection{
-		schniffs:     make([]*Schniff, 0),
-		mutex:        sync.Mutex{},
-		fileLocation: "example_schniffs.json",
+	// the example schniff is archived, so this test gets its own active copy of it
+	exampleSchniffs, err := NewJSONSchniffStore("example_schniffs.json").Load()
+	if err != nil {
+		t.Fatalf("Error loading example_schniffs.json: %v", err)
+	}
+	for _, schniff := range exampleSchniffs {
+		schniff.Active = true
 	}
-	sc.load()
+	sc := newTestSchniffCollection(t, exampleSchniffs...)
 
 	// Read and unmarshal the availabilities.json file
 	availabilitiesFile, err := os.ReadFile("availability.json")
@@ -36,7 +40,11 @@ func TestGenerateNotifications(t *testing.T) {
 	}
 
 	// Run the GenerateNotifications function
-	notifications, records, err := GenerateNotifications(ctx, logger, availabilities, sc, []NotificationRecord{})
+	rs, err := NewNotificationRecordStore("", RecordRetention{})
+	if err != nil {
+		t.Fatalf("Error creating notification record store: %v", err)
+	}
+	notifications, records, err := GenerateNotifications(ctx, logger, availabilities, sc, rs, NewChangeTracker(nil))
 	if err != nil {
 		t.Fatalf("Error in GenerateNotifications function: %v", err)
 	}
@@ -65,3 +73,473 @@ func TestGenerateNotifications(t *testing.T) {
 
 	// Add more assertions as needed...
 }
+
+func TestGenerateNotificationsMinimumConsecutiveDays(t *testing.T) {
+	ctx := context.Background()
+	logger, _ := zap.NewDevelopment()
+
+	sc := newTestSchniffCollection(t,
+		&Schniff{
+			SchniffID:              "three-nights",
+			Active:                 true,
+			CampgroundID:           "camp1",
+			StartDate:              time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:                time.Date(2023, 8, 31, 0, 0, 0, 0, time.UTC),
+			MinimumConsecutiveDays: 3,
+		},
+	)
+
+	// site1 has a run of 3 nights over the end of july and a stray night in august.
+	// site2 only has a run of 2 nights.
+	availabilities := []AvailabilityWithID{
+		{
+			CampgroundID: "camp1",
+			Availability: Availability{Campsites: map[string]Campsite{
+				"site1": {Availabilities: map[string]string{
+					"2023-07-30T00:00:00Z": "Available",
+					"2023-07-31T00:00:00Z": "Available",
+				}},
+				"site2": {Availabilities: map[string]string{
+					"2023-07-30T00:00:00Z": "Reserved",
+					"2023-07-31T00:00:00Z": "Available",
+				}},
+			}},
+		},
+		{
+			CampgroundID: "camp1",
+			Availability: Availability{Campsites: map[string]Campsite{
+				"site1": {Availabilities: map[string]string{
+					"2023-08-01T00:00:00Z": "Available",
+					"2023-08-02T00:00:00Z": "Reserved",
+					"2023-08-10T00:00:00Z": "Available",
+				}},
+				"site2": {Availabilities: map[string]string{
+					"2023-08-01T00:00:00Z": "Available",
+				}},
+			}},
+		},
+	}
+
+	rs, err := NewNotificationRecordStore(filepath.Join(t.TempDir(), "records.json"), RecordRetention{})
+	if err != nil {
+		t.Fatalf("Error creating notification record store: %v", err)
+	}
+	notifications, records, err := GenerateNotifications(ctx, logger, availabilities, sc, rs, NewChangeTracker(nil))
+	if err != nil {
+		t.Fatalf("Error in GenerateNotifications function: %v", err)
+	}
+
+	if len(notifications) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(notifications))
+	}
+
+	runs := FindConsecutiveRuns(notifications[0].AvailableCampsites)
+	expected := []ConsecutiveRun{
+		{
+			CampsiteID: "site1",
+			Start:      time.Date(2023, 7, 30, 0, 0, 0, 0, time.UTC),
+			End:        time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	if diff := cmp.Diff(expected, runs); diff != "" {
+		t.Errorf("Runs mismatch (-want +got):\n%s", diff)
+	}
+
+	if len(records) != 3 {
+		t.Errorf("Expected 3 records, got %d", len(records))
+	}
+
+	// once the run has been notified it shouldn't come up again
+	err = rs.Add(records...)
+	if err != nil {
+		t.Fatalf("Error adding records: %v", err)
+	}
+	notifications, _, err = GenerateNotifications(ctx, logger, availabilities, sc, rs, NewChangeTracker(nil))
+	if err != nil {
+		t.Fatalf("Error in GenerateNotifications function: %v", err)
+	}
+	if len(notifications) != 0 {
+		t.Errorf("Expected no notifications after recording, got %d", len(notifications))
+	}
+}
+
+func TestGenerateNotificationsCampsiteIDs(t *testing.T) {
+	ctx := context.Background()
+	logger, _ := zap.NewDevelopment()
+
+	sc := newTestSchniffCollection(t,
+		&Schniff{
+			SchniffID:    "site2-only",
+			Active:       true,
+			CampgroundID: "camp1",
+			CampsiteIDs:  []string{"site2"},
+			StartDate:    time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:      time.Date(2023, 8, 31, 0, 0, 0, 0, time.UTC),
+		},
+	)
+
+	availabilities := []AvailabilityWithID{
+		{
+			CampgroundID: "camp1",
+			Availability: Availability{Campsites: map[string]Campsite{
+				"site1": {Availabilities: map[string]string{"2023-08-01T00:00:00Z": "Available"}},
+				"site2": {Availabilities: map[string]string{"2023-08-02T00:00:00Z": "Available"}},
+				"site3": {Availabilities: map[string]string{"2023-08-03T00:00:00Z": "Available"}},
+			}},
+		},
+	}
+
+	rs, err := NewNotificationRecordStore("", RecordRetention{})
+	if err != nil {
+		t.Fatalf("Error creating notification record store: %v", err)
+	}
+	notifications, _, err := GenerateNotifications(ctx, logger, availabilities, sc, rs, NewChangeTracker(nil))
+	if err != nil {
+		t.Fatalf("Error in GenerateNotifications function: %v", err)
+	}
+
+	if len(notifications) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(notifications))
+	}
+
+	expected := []CampsiteAvailability{
+		{CampsiteID: "site2", Date: time.Date(2023, 8, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	if diff := cmp.Diff(expected, notifications[0].AvailableCampsites); diff != "" {
+		t.Errorf("Campsites mismatch (-want +got):\n%s", diff)
+	}
+
+	unknown := FindUnknownCampsites(CampsitesFromAvailability(availabilities[0].Availability), ParseCampsiteList(" site1, site4,,site3 "))
+	if diff := cmp.Diff([]string{"site4"}, unknown); diff != "" {
+		t.Errorf("Unknown campsites mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateNotificationsCheckInDays(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	// 2023-06-09 is a friday
+	sc := newTestSchniffCollection(t,
+		&Schniff{
+			SchniffID:              "weekends",
+			Active:                 true,
+			CampgroundID:           "camp1",
+			StartDate:              time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:                time.Date(2023, 6, 30, 0, 0, 0, 0, time.UTC),
+			MinimumConsecutiveDays: 2,
+			CheckInDays:            []time.Weekday{time.Friday},
+		},
+	)
+
+	// site1 is open tuesday to sunday, so the stay starts friday. site2 is open saturday and sunday, which
+	// doesn't start on a friday. site3 only has friday night free, which is too short.
+	availabilities := []AvailabilityWithID{
+		{
+			CampgroundID: "camp1",
+			Availability: Availability{Campsites: map[string]Campsite{
+				"site1": {Availabilities: map[string]string{
+					"2023-06-06T00:00:00Z": StateAvailable,
+					"2023-06-07T00:00:00Z": StateAvailable,
+					"2023-06-08T00:00:00Z": StateAvailable,
+					"2023-06-09T00:00:00Z": StateAvailable,
+					"2023-06-10T00:00:00Z": StateAvailable,
+					"2023-06-11T00:00:00Z": StateAvailable,
+				}},
+				"site2": {Availabilities: map[string]string{
+					"2023-06-10T00:00:00Z": StateAvailable,
+					"2023-06-11T00:00:00Z": StateAvailable,
+				}},
+				"site3": {Availabilities: map[string]string{
+					"2023-06-09T00:00:00Z": StateAvailable,
+					"2023-06-10T00:00:00Z": StateReserved,
+				}},
+			}},
+		},
+	}
+
+	rs, err := NewNotificationRecordStore("", RecordRetention{})
+	if err != nil {
+		t.Fatalf("Error creating notification record store: %v", err)
+	}
+	notifications, _, err := GenerateNotifications(ctx, logger, availabilities, sc, rs, NewChangeTracker(nil))
+	if err != nil {
+		t.Fatalf("Error in GenerateNotifications function: %v", err)
+	}
+	if len(notifications) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(notifications))
+	}
+
+	expected := []ConsecutiveRun{
+		{
+			CampsiteID: "site1",
+			Start:      time.Date(2023, 6, 9, 0, 0, 0, 0, time.UTC),
+			End:        time.Date(2023, 6, 11, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	if diff := cmp.Diff(expected, FindConsecutiveRuns(notifications[0].AvailableCampsites)); diff != "" {
+		t.Errorf("Runs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateNotificationsStayLength(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	day := func(d int) time.Time { return time.Date(2023, 6, d, 0, 0, 0, 0, time.UTC) }
+
+	sc := newTestSchniffCollection(t,
+		&Schniff{SchniffID: "flexible", Active: true, CampgroundID: "camp1", StartDate: day(1), EndDate: day(30), StayLength: 2},
+	)
+
+	// four nights in a row at site1 fit three different two night stays. site2 only has one night.
+	availabilities := []AvailabilityWithID{
+		{
+			CampgroundID: "camp1",
+			Availability: Availability{Campsites: map[string]Campsite{
+				"site1": {Availabilities: map[string]string{
+					"2023-06-05T00:00:00Z": StateAvailable,
+					"2023-06-06T00:00:00Z": StateAvailable,
+					"2023-06-07T00:00:00Z": StateAvailable,
+					"2023-06-08T00:00:00Z": StateAvailable,
+				}},
+				"site2": {Availabilities: map[string]string{
+					"2023-06-05T00:00:00Z": StateAvailable,
+				}},
+			}},
+		},
+	}
+
+	rs, err := NewNotificationRecordStore("", RecordRetention{})
+	if err != nil {
+		t.Fatalf("Error creating notification record store: %v", err)
+	}
+	ct := NewChangeTracker(nil)
+	notifications, records, err := GenerateNotifications(ctx, logger, availabilities, sc, rs, ct)
+	if err != nil {
+		t.Fatalf("Error in GenerateNotifications function: %v", err)
+	}
+	if len(notifications) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(notifications))
+	}
+
+	expected := []Stay{
+		{CampsiteID: "site1", CheckIn: day(5), CheckOut: day(7)},
+		{CampsiteID: "site1", CheckIn: day(6), CheckOut: day(8)},
+		{CampsiteID: "site1", CheckIn: day(7), CheckOut: day(9)},
+	}
+	if diff := cmp.Diff(expected, notifications[0].Stays); diff != "" {
+		t.Errorf("Stays mismatch (-want +got):\n%s", diff)
+	}
+	if len(notifications[0].AvailableCampsites) != 4 || len(records) != 4 {
+		t.Errorf("Expected each night once, got %d nights and %d records", len(notifications[0].AvailableCampsites), len(records))
+	}
+
+	// each stay is only reported once
+	err = rs.Add(records...)
+	if err != nil {
+		t.Fatalf("Error adding records: %v", err)
+	}
+	notifications, _, err = GenerateNotifications(ctx, logger, availabilities, sc, rs, ct)
+	if err != nil {
+		t.Fatalf("Error in GenerateNotifications function: %v", err)
+	}
+	if len(notifications) != 0 {
+		t.Errorf("Expected no notifications after recording, got %d", len(notifications))
+	}
+}
+
+// juneSchniff makes the schniff active on camp1 for all of june 2023, leaving its filters as they are
+func juneSchniff(schniff Schniff) *Schniff {
+	schniff.Active = true
+	schniff.CampgroundID = "camp1"
+	schniff.StartDate = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	schniff.EndDate = time.Date(2023, 6, 30, 0, 0, 0, 0, time.UTC)
+	return &schniff
+}
+
+// generateTestNotifications runs a single cycle of notifications for the schniffs against camp1's campsites,
+// with nothing notified before
+func generateTestNotifications(t *testing.T, campsites map[string]Campsite, schniffs ...*Schniff) []Notification {
+	t.Helper()
+
+	sc := newTestSchniffCollection(t, schniffs...)
+	rs, err := NewNotificationRecordStore("", RecordRetention{})
+	if err != nil {
+		t.Fatalf("Error creating notification record store: %v", err)
+	}
+
+	availabilities := []AvailabilityWithID{
+		{CampgroundID: "camp1", Availability: Availability{Campsites: campsites}},
+	}
+	notifications, _, err := GenerateNotifications(context.Background(), zap.NewNop(), availabilities, sc, rs, NewChangeTracker(nil))
+	if err != nil {
+		t.Fatalf("Error in GenerateNotifications function: %v", err)
+	}
+	return notifications
+}
+
+func TestGenerateNotificationsPartySize(t *testing.T) {
+	night := map[string]string{"2023-06-05T00:00:00Z": StateAvailable}
+	notifications := generateTestNotifications(t,
+		map[string]Campsite{
+			"small":   {Availabilities: night, MaxNumPeople: 4},
+			"group":   {Availabilities: night, MinNumPeople: 2, MaxNumPeople: 12},
+			"big":     {Availabilities: night, MinNumPeople: 15, MaxNumPeople: 40},
+			"unknown": {Availabilities: night},
+		},
+		juneSchniff(Schniff{SchniffID: "group", PartySize: 10}),
+	)
+	if len(notifications) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(notifications))
+	}
+
+	// sites that don't say how many they fit are left in
+	expected := []CampsiteAvailability{
+		{CampsiteID: "group", Date: time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC), MinNumPeople: 2, MaxNumPeople: 12},
+		{CampsiteID: "unknown", Date: time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	if diff := cmp.Diff(expected, notifications[0].AvailableCampsites); diff != "" {
+		t.Errorf("Campsites mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// campsitesBySchniff lists the campsites each schniff was notified about
+func campsitesBySchniff(notifications []Notification) map[string][]string {
+	got := make(map[string][]string)
+	for _, notification := range notifications {
+		for _, run := range FindConsecutiveRuns(notification.AvailableCampsites) {
+			got[notification.SchniffID] = append(got[notification.SchniffID], run.CampsiteID)
+		}
+	}
+	return got
+}
+
+func TestGenerateNotificationsCampsiteTypes(t *testing.T) {
+	night := map[string]string{"2023-06-05T00:00:00Z": StateAvailable}
+	notifications := generateTestNotifications(t,
+		map[string]Campsite{
+			"standard":   {Availabilities: night, CampsiteType: "STANDARD NONELECTRIC", TypeOfUse: "Overnight"},
+			"rv":         {Availabilities: night, CampsiteType: "RV ELECTRIC", TypeOfUse: "Overnight"},
+			"horses":     {Availabilities: night, CampsiteType: "EQUESTRIAN NONELECTRIC", TypeOfUse: "Overnight"},
+			"picnic":     {Availabilities: night, CampsiteType: "STANDARD NONELECTRIC", TypeOfUse: "Day"},
+			"rv-day-use": {Availabilities: night, CampsiteType: "RV ELECTRIC", TypeOfUse: "Day"},
+		},
+		juneSchniff(Schniff{SchniffID: "tents", ExcludeTypes: []string{"equestrian nonelectric"}, TypeOfUse: "overnight"}),
+		juneSchniff(Schniff{SchniffID: "rv", IncludeTypes: []string{"RV ELECTRIC"}}),
+	)
+
+	expected := map[string][]string{
+		"tents": {"rv", "standard"},
+		"rv":    {"rv", "rv-day-use"},
+	}
+	if diff := cmp.Diff(expected, campsitesBySchniff(notifications)); diff != "" {
+		t.Errorf("Campsites mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateNotificationsLoops(t *testing.T) {
+	night := map[string]string{"2023-06-05T00:00:00Z": StateAvailable}
+	notifications := generateTestNotifications(t,
+		map[string]Campsite{
+			"1": {Availabilities: night, Loop: "Lakeside"},
+			"2": {Availabilities: night, Loop: "Meadow"},
+			"3": {Availabilities: night, Loop: "Hilltop"},
+			"4": {Availabilities: night},
+		},
+		juneSchniff(Schniff{SchniffID: "lakeside", Loops: []string{"lakeside", "Meadow"}}),
+		juneSchniff(Schniff{SchniffID: "anywhere"}),
+	)
+
+	got := make(map[string]map[string]string)
+	for _, notification := range notifications {
+		got[notification.SchniffID] = make(map[string]string)
+		for _, availability := range notification.AvailableCampsites {
+			got[notification.SchniffID][availability.CampsiteID] = availability.Loop
+		}
+	}
+	expected := map[string]map[string]string{
+		"lakeside": {"1": "Lakeside", "2": "Meadow"},
+		"anywhere": {"1": "Lakeside", "2": "Meadow", "3": "Hilltop", "4": ""},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Campsites mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateNotificationsCampsiteDetails(t *testing.T) {
+	night := map[string]string{"2023-06-05T00:00:00Z": StateAvailable}
+	notifications := generateTestNotifications(t,
+		map[string]Campsite{
+			"long":       {Availabilities: night, Details: &CampsiteDetails{MaxVehicleLength: 35}},
+			"short":      {Availabilities: night, Details: &CampsiteDetails{MaxVehicleLength: 20, Accessible: true, PetsAllowed: true}},
+			"accessible": {Availabilities: night, Details: &CampsiteDetails{Accessible: true}},
+			"unknown":    {Availabilities: night},
+		},
+		juneSchniff(Schniff{SchniffID: "rv", VehicleLength: 30}),
+		juneSchniff(Schniff{SchniffID: "accessible", AccessibleOnly: true, WithPets: true}),
+		juneSchniff(Schniff{SchniffID: "anything"}),
+	)
+
+	expected := map[string][]string{
+		"rv":         {"long"},
+		"accessible": {"short"},
+		"anything":   {"accessible", "long", "short", "unknown"},
+	}
+	if diff := cmp.Diff(expected, campsitesBySchniff(notifications)); diff != "" {
+		t.Errorf("Campsites mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateNotificationsWaitsForCampsiteDetails(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	store, err := NewSnapshotStore(filepath.Join(t.TempDir(), "snapshots.db"))
+	if err != nil {
+		t.Fatalf("Failed to open snapshot store: %v", err)
+	}
+	defer store.Close()
+	ct := NewChangeTracker(store)
+
+	sc := newTestSchniffCollection(t, juneSchniff(Schniff{SchniffID: "rv", VehicleLength: 30}))
+	rs, err := NewNotificationRecordStore("", RecordRetention{})
+	if err != nil {
+		t.Fatalf("Error creating notification record store: %v", err)
+	}
+
+	request := AvailabilityRequest{Provider: ProviderRecreationGov, CampgroundID: "camp1", TargetTime: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)}
+	night := map[string]string{"2023-06-05T00:00:00Z": StateAvailable}
+	cycle := func(now time.Time, details *CampsiteDetails) []Notification {
+		t.Helper()
+		result := AvailabilityResult{Request: request, Availability: AvailabilityWithID{CampgroundID: "camp1", Availability: Availability{Campsites: map[string]Campsite{
+			"long": {Availabilities: night, Details: details},
+		}}}}
+		_, err := ct.Update([]AvailabilityResult{result}, now)
+		if err != nil {
+			t.Fatalf("Failed to update change tracker: %v", err)
+		}
+		notifications, records, err := GenerateNotifications(ctx, logger, []AvailabilityWithID{result.Availability}, sc, rs, ct)
+		if err != nil {
+			t.Fatalf("Error in GenerateNotifications function: %v", err)
+		}
+		err = rs.Add(records...)
+		if err != nil {
+			t.Fatalf("Failed to add records: %v", err)
+		}
+		return notifications
+	}
+
+	now := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	// the catalog hasn't got the campground yet, so nothing matches and the schniff isn't primed
+	if notifications := cycle(now, nil); len(notifications) != 0 {
+		t.Errorf("Expected no notifications without details, got %+v", notifications)
+	}
+	// the site was open all along, so it's only heard about because the schniff waited for the details
+	notifications := cycle(now.Add(time.Minute), &CampsiteDetails{MaxVehicleLength: 35})
+	if len(notifications) != 1 || len(notifications[0].AvailableCampsites) != 1 {
+		t.Errorf("Expected the open site once the details arrived, got %+v", notifications)
+	}
+	if notifications := cycle(now.Add(2*time.Minute), &CampsiteDetails{MaxVehicleLength: 35}); len(notifications) != 0 {
+		t.Errorf("Expected no more notifications once primed, got %+v", notifications)
+	}
+}
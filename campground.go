@@ -4,16 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"sync"
 	"time"
 
-	"github.com/brensch/campbot/stealthing"
-	"github.com/bwmarrin/discordgo"
 	"go.uber.org/zap"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 )
 
 type CampgroundCollection struct {
@@ -108,77 +103,7 @@ type SummarisedCampground struct {
 	Rating     float64
 }
 
-// GetCampgrounds retrieves all campgrounds. It looks like they forgot to actually apply the limit that you
-// specify, meaning we can get the entire database in one call. Should only do this once every week or so to
-// be kind.
-func CampgroundRequest(ctx context.Context, log *zap.Logger, client *http.Client, start int) (CampgroundSearchResults, error) {
-	log.Debug("getting campground")
-	endpoint := fmt.Sprintf("https://recreation.gov/api/search?fq=entity_type%%3Acampground&size=100&start=%d", start)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		log.Error("couldn't create request", zap.Error(err))
-		return CampgroundSearchResults{}, err
-	}
-	req.Header.Set("User-Agent", stealthing.RandomUserAgent())
-
-	res, err := client.Do(req)
-	if err != nil {
-		log.Error("couldn't do request", zap.Error(err))
-		return CampgroundSearchResults{}, err
-	}
-	defer res.Body.Close()
-
-	var target CampgroundSearchResults
-	err = json.NewDecoder(res.Body).Decode(&target)
-	if err != nil {
-		log.Error("couldn't decode campground response", zap.Error(err))
-		return CampgroundSearchResults{}, err
-	}
-
-	return target, nil
-}
-
-func SummariseCampground(apiCampground Campground) SummarisedCampground {
-	campground := SummarisedCampground{
-		Source: "recreation.gov",
-
-		ID:         apiCampground.EntityID,
-		Name:       cases.Title(language.Und).String(apiCampground.Name),
-		ParentName: apiCampground.ParentName,
-		Rating:     apiCampground.AverageRating,
-	}
-
-	return campground
-}
-
-// GetCampgrounds iterates through the search api until all campgrounds are retrieved
-func GetCampgrounds(ctx context.Context, log *zap.Logger, client *http.Client) ([]SummarisedCampground, error) {
-
-	page := 0
-	startingSize := 100
-	size := startingSize
-	var campgrounds []SummarisedCampground
-
-	// 100 indicates that we received a partial page, and are therefore at the end
-	for size == startingSize {
-		log.Debug("getting campground page", zap.Int("page", page))
-		apiCampgrounds, err := CampgroundRequest(ctx, log.With(), client, page)
-		if err != nil {
-			log.Error("got error getting campgrounds", zap.Error(err))
-			return nil, err
-		}
-		for _, apiCampground := range apiCampgrounds.Results {
-			campgrounds = append(campgrounds, SummariseCampground(apiCampground))
-		}
-
-		size = apiCampgrounds.Size
-		page = page + size
-	}
-
-	return campgrounds, nil
-}
-
-func NewCampgroundCollection(ctx context.Context, log *zap.Logger, s *discordgo.Session, client *http.Client) (*CampgroundCollection, error) {
+func NewCampgroundCollection(ctx context.Context, log *zap.Logger, providers ProviderRegistry) (*CampgroundCollection, error) {
 	// get campgrounds if campgrounds.json doesn't exist
 	cc := &CampgroundCollection{
 		mu: sync.Mutex{},
@@ -187,7 +112,7 @@ func NewCampgroundCollection(ctx context.Context, log *zap.Logger, s *discordgo.
 	_, err := os.Stat("campgrounds.json")
 	if os.IsNotExist(err) {
 		// update campgrounds
-		err = cc.UpdateCampgrounds(ctx, log, s, client)
+		err = cc.UpdateCampgrounds(ctx, log, providers)
 		if err != nil {
 			log.Error("couldn't update campgrounds", zap.Error(err))
 			return nil, err
@@ -208,18 +133,64 @@ func NewCampgroundCollection(ctx context.Context, log *zap.Logger, s *discordgo.
 		return nil, err
 	}
 
+	// providers added since the file was written won't be in it yet
+	err = cc.addMissingProviders(ctx, log, providers)
+	if err != nil {
+		log.Error("couldn't add campgrounds for new providers", zap.Error(err))
+		return nil, err
+	}
+
 	return cc, nil
 }
 
-// UpdateCampgrounds updates the campground colleciton with the latest campgrounds
-func (cc *CampgroundCollection) UpdateCampgrounds(ctx context.Context, log *zap.Logger, s *discordgo.Session, client *http.Client) error {
-	// get campgrounds
-	campgrounds, err := GetCampgrounds(ctx, log, s.Client)
+// addMissingProviders gets the campgrounds for any provider that doesn't have any in the collection
+func (cc *CampgroundCollection) addMissingProviders(ctx context.Context, log *zap.Logger, providers ProviderRegistry) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	sources := make(map[string]struct{})
+	for _, campground := range cc.Campgrounds {
+		sources[campground.Source] = struct{}{}
+	}
+
+	added := false
+	for _, name := range providers.Names() {
+		if _, ok := sources[name]; ok {
+			continue
+		}
+		providerCampgrounds, err := providers[name].GetCampgrounds(ctx, log.With(zap.String("provider", name)))
+		if err != nil {
+			return err
+		}
+		cc.Campgrounds = append(cc.Campgrounds, providerCampgrounds...)
+		added = true
+	}
+
+	if !added {
+		return nil
+	}
+
+	campgroundsJSON, err := json.Marshal(cc.Campgrounds)
 	if err != nil {
-		log.Error("Cannot open the session", zap.Error(err))
 		return err
 	}
 
+	return os.WriteFile("campgrounds.json", campgroundsJSON, 0644)
+}
+
+// UpdateCampgrounds updates the campground colleciton with the latest campgrounds from every provider
+func (cc *CampgroundCollection) UpdateCampgrounds(ctx context.Context, log *zap.Logger, providers ProviderRegistry) error {
+	// get campgrounds
+	var campgrounds []SummarisedCampground
+	for _, name := range providers.Names() {
+		providerCampgrounds, err := providers[name].GetCampgrounds(ctx, log.With(zap.String("provider", name)))
+		if err != nil {
+			log.Error("Cannot get campgrounds", zap.String("provider", name), zap.Error(err))
+			return err
+		}
+		campgrounds = append(campgrounds, providerCampgrounds...)
+	}
+
 	campgroundsJSON, err := json.Marshal(campgrounds)
 	if err != nil {
 		log.Error("cannot marshal campgrounds", zap.Error(err))
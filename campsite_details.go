@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CampsiteDetails are the things about a campsite that don't come with its availability
+type CampsiteDetails struct {
+	// MaxVehicleLength is the longest vehicle that fits in feet, zero if we don't know
+	MaxVehicleLength int `json:"max_vehicle_length,omitempty"`
+	// Driveway is what the driveway is made of, eg Paved
+	Driveway string `json:"driveway,omitempty"`
+	// Shade is how much shade the campsite gets, eg Full or Partial
+	Shade       string `json:"shade,omitempty"`
+	Accessible  bool   `json:"accessible,omitempty"`
+	PetsAllowed bool   `json:"pets_allowed,omitempty"`
+}
+
+// String lists the details we know, eg RV up to 30ft, Paved driveway, Accessible
+func (d CampsiteDetails) String() string {
+	var details []string
+	if d.MaxVehicleLength > 0 {
+		details = append(details, fmt.Sprintf("RV up to %dft", d.MaxVehicleLength))
+	}
+	if d.Driveway != "" {
+		details = append(details, fmt.Sprintf("%s driveway", d.Driveway))
+	}
+	if d.Shade != "" && !strings.EqualFold(d.Shade, "no") {
+		details = append(details, fmt.Sprintf("Shade: %s", d.Shade))
+	}
+	if d.Accessible {
+		details = append(details, "Accessible")
+	}
+	if d.PetsAllowed {
+		details = append(details, "Pets allowed")
+	}
+	return strings.Join(details, ", ")
+}
+
+// CampsiteCatalogConfig controls how campsite details are cached
+type CampsiteCatalogConfig struct {
+	File string
+	// MaxAge is how long the details of a campground are kept before they're fetched again
+	MaxAge time.Duration
+	// Interval is how often the catalog looks for campgrounds that need fetching
+	Interval time.Duration
+}
+
+type campsiteCatalogEntry struct {
+	FetchedAt time.Time                  `json:"fetched_at"`
+	Campsites map[string]CampsiteDetails `json:"campsites"`
+}
+
+// CampsiteCatalog caches the details of the campsites at every campground being schniffed. Details barely
+// change and take a slow request to get, so they're fetched in the background and only every MaxAge.
+type CampsiteCatalog struct {
+	providers ProviderRegistry
+	config    CampsiteCatalogConfig
+
+	mu sync.Mutex
+	// entries is keyed by campgroundKey
+	entries map[string]campsiteCatalogEntry
+}
+
+// NewCampsiteCatalog loads the details fetched before from config.File. An empty File keeps them in memory
+// only.
+func NewCampsiteCatalog(providers ProviderRegistry, config CampsiteCatalogConfig) (*CampsiteCatalog, error) {
+	catalog := &CampsiteCatalog{
+		providers: providers,
+		config:    config,
+		entries:   make(map[string]campsiteCatalogEntry),
+	}
+	if config.File == "" {
+		return catalog, nil
+	}
+
+	data, err := os.ReadFile(config.File)
+	if os.IsNotExist(err) {
+		return catalog, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &catalog.entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+// Details gets the details of the campsites at the campground, if we have them
+func (cat *CampsiteCatalog) Details(provider, campgroundID string) (map[string]CampsiteDetails, bool) {
+	cat.mu.Lock()
+	defer cat.mu.Unlock()
+
+	entry, ok := cat.entries[campgroundKey(providerOrDefault(provider), campgroundID)]
+	return entry.Campsites, ok
+}
+
+// Annotate sets the details on every campsite in the successful results that we have details for
+func (cat *CampsiteCatalog) Annotate(results []AvailabilityResult) {
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		details, ok := cat.Details(result.Availability.Provider, result.Availability.CampgroundID)
+		if !ok {
+			continue
+		}
+
+		for campsiteID, campsite := range result.Availability.Availability.Campsites {
+			campsiteDetails, ok := details[campsiteID]
+			if !ok {
+				continue
+			}
+			campsite.Details = &campsiteDetails
+			result.Availability.Availability.Campsites[campsiteID] = campsite
+		}
+	}
+}
+
+type catalogCampground struct {
+	provider     string
+	campgroundID string
+}
+
+// stale lists the campgrounds of active schniffs that we don't have details for, or whose details are older
+// than MaxAge
+func (cat *CampsiteCatalog) stale(sc *SchniffCollection, now time.Time) []catalogCampground {
+	cat.mu.Lock()
+	defer cat.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	var stale []catalogCampground
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	for _, schniff := range sc.schniffs {
+		if !schniff.Active {
+			continue
+		}
+		key := campgroundKey(schniff.ProviderName(), schniff.CampgroundID)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		entry, ok := cat.entries[key]
+		if ok && now.Sub(entry.FetchedAt) < cat.config.MaxAge {
+			continue
+		}
+		stale = append(stale, catalogCampground{provider: schniff.ProviderName(), campgroundID: schniff.CampgroundID})
+	}
+
+	sort.Slice(stale, func(i, j int) bool {
+		return campgroundKey(stale[i].provider, stale[i].campgroundID) < campgroundKey(stale[j].provider, stale[j].campgroundID)
+	})
+	return stale
+}
+
+// Refresh fetches the details of every stale campground and saves the catalog. A campground that fails is
+// left as it was so it's tried again next time.
+func (cat *CampsiteCatalog) Refresh(ctx context.Context, log *zap.Logger, sc *SchniffCollection, now time.Time) (int, error) {
+	var errs []string
+	refreshed := 0
+	for _, campground := range cat.stale(sc, now) {
+		providerName, campgroundID := campground.provider, campground.campgroundID
+		provider, err := cat.providers.Get(providerName)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		details, err := provider.GetCampsiteDetails(ctx, log, campgroundID)
+		if err != nil {
+			log.Warn("Cannot get campsite details", zap.String("provider", providerName), zap.String("campground", campgroundID), zap.Error(err))
+			errs = append(errs, fmt.Sprintf("%s: %s", campgroundKey(providerName, campgroundID), err))
+			continue
+		}
+
+		cat.mu.Lock()
+		cat.entries[campgroundKey(providerName, campgroundID)] = campsiteCatalogEntry{
+			FetchedAt: now,
+			Campsites: details,
+		}
+		cat.mu.Unlock()
+		refreshed++
+	}
+
+	if refreshed > 0 {
+		err := cat.save()
+		if err != nil {
+			return refreshed, err
+		}
+	}
+	if len(errs) > 0 {
+		return refreshed, fmt.Errorf("couldn't get campsite details: %s", strings.Join(errs, ", "))
+	}
+	return refreshed, nil
+}
+
+func (cat *CampsiteCatalog) save() error {
+	if cat.config.File == "" {
+		return nil
+	}
+
+	cat.mu.Lock()
+	data, err := json.MarshalIndent(cat.entries, "", "  ")
+	cat.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(cat.config.File), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpLocation := cat.config.File + ".tmp"
+	err = os.WriteFile(tmpLocation, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpLocation, cat.config.File)
+}
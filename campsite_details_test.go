@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+func TestCampsiteCatalog(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	config := CampsiteCatalogConfig{File: filepath.Join(t.TempDir(), "campsite_details.json"), MaxAge: 7 * 24 * time.Hour}
+
+	provider := &fakeProvider{
+		name: "fake",
+		details: map[string]map[string]CampsiteDetails{
+			"camp1": {"site1": {MaxVehicleLength: 30, Accessible: true}},
+		},
+		errs: map[string]error{"broken": errors.New("Got bad status code: 500")},
+	}
+	providers := NewProviderRegistry(provider)
+	sc := newTestSchniffCollection(t,
+		&Schniff{SchniffID: "a", Active: true, Provider: "fake", CampgroundID: "camp1"},
+		&Schniff{SchniffID: "b", Active: true, Provider: "fake", CampgroundID: "camp1"},
+		&Schniff{SchniffID: "c", Active: true, Provider: "fake", CampgroundID: "broken"},
+		&Schniff{SchniffID: "d", Active: false, Provider: "fake", CampgroundID: "stopped"},
+	)
+
+	catalog, err := NewCampsiteCatalog(providers, config)
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+	refreshed, err := catalog.Refresh(ctx, logger, sc, now)
+	if err == nil {
+		t.Error("Expected an error for the broken campground")
+	}
+	if refreshed != 1 {
+		t.Errorf("Expected 1 campground refreshed, got %d", refreshed)
+	}
+
+	// the broken campground is tried again, the fresh one isn't until it's too old
+	if diff := cmp.Diff([]catalogCampground{{provider: "fake", campgroundID: "broken"}}, catalog.stale(sc, now.Add(24*time.Hour)), cmp.AllowUnexported(catalogCampground{})); diff != "" {
+		t.Errorf("Stale campgrounds mismatch (-want +got):\n%s", diff)
+	}
+	if stale := catalog.stale(sc, now.Add(config.MaxAge)); len(stale) != 2 {
+		t.Errorf("Expected both campgrounds to be stale after max age, got %+v", stale)
+	}
+
+	// the details survive a restart
+	reloaded, err := NewCampsiteCatalog(providers, config)
+	if err != nil {
+		t.Fatalf("Failed to reload catalog: %v", err)
+	}
+	details, ok := reloaded.Details("fake", "camp1")
+	if !ok || details["site1"].MaxVehicleLength != 30 {
+		t.Errorf("Expected reloaded details for camp1, got %+v", details)
+	}
+
+	results := []AvailabilityResult{
+		{Availability: AvailabilityWithID{Provider: "fake", CampgroundID: "camp1", Availability: Availability{Campsites: map[string]Campsite{
+			"site1": {},
+			"site2": {},
+		}}}},
+	}
+	reloaded.Annotate(results)
+	campsites := results[0].Availability.Availability.Campsites
+	if campsites["site1"].Details == nil || !campsites["site1"].Details.Accessible {
+		t.Errorf("Expected site1 to have details, got %+v", campsites["site1"].Details)
+	}
+	if campsites["site2"].Details != nil {
+		t.Errorf("Expected site2 to have no details, got %+v", campsites["site2"].Details)
+	}
+}
+
+func TestRecreationGovCampsiteDetails(t *testing.T) {
+	data := `{"campsites": [
+		{"campsite_id": "71047", "accessible": false, "attributes": [
+			{"attribute_name": "Max Vehicle Length", "attribute_value": "35"},
+			{"attribute_name": "Driveway Surface", "attribute_value": "Paved"},
+			{"attribute_name": "Shade", "attribute_value": "Partial"},
+			{"attribute_name": "Pets Allowed", "attribute_value": "Domestic"}
+		]},
+		{"campsite_id": "71048", "accessible": true, "attributes": [
+			{"attribute_name": "Pets Allowed", "attribute_value": "No"}
+		], "permitted_equipment": [
+			{"equipment_name": "Tent", "max_length": 0},
+			{"equipment_name": "Trailer", "max_length": 24}
+		]}
+	], "size": 2, "total": 2}`
+
+	var search recreationGovCampsiteSearch
+	err := json.Unmarshal([]byte(data), &search)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal campsite search: %v", err)
+	}
+
+	got := make(map[string]CampsiteDetails)
+	for _, campsite := range search.Campsites {
+		got[campsite.CampsiteID] = campsite.details()
+	}
+	expected := map[string]CampsiteDetails{
+		"71047": {MaxVehicleLength: 35, Driveway: "Paved", Shade: "Partial", PetsAllowed: true},
+		"71048": {MaxVehicleLength: 24, Accessible: true},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Details mismatch (-want +got):\n%s", diff)
+	}
+
+	if description := got["71047"].String(); description != "RV up to 35ft, Paved driveway, Shade: Partial, Pets allowed" {
+		t.Errorf("Unexpected description: %s", description)
+	}
+}
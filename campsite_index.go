@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// CampsiteIndex remembers what the campsites at each campground are like, from every fetch we make, so that
+// commands can offer the campsite types and loops a campground actually has. Campgrounds we haven't fetched
+// yet are looked up from their provider.
+type CampsiteIndex struct {
+	providers ProviderRegistry
+
+	mu sync.Mutex
+	// campgrounds is keyed by campgroundKey then campsite ID. The campsites have no availabilities.
+	campgrounds map[string]map[string]Campsite
+}
+
+func NewCampsiteIndex(providers ProviderRegistry) *CampsiteIndex {
+	return &CampsiteIndex{
+		providers:   providers,
+		campgrounds: make(map[string]map[string]Campsite),
+	}
+}
+
+// Update adds the campsites from every successful result
+func (ci *CampsiteIndex) Update(results []AvailabilityResult) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		key := campgroundKey(result.Availability.Provider, result.Availability.CampgroundID)
+
+		// the maps handed out by Campsites are never changed, so build a new one
+		campsites := make(map[string]Campsite, len(ci.campgrounds[key]))
+		for campsiteID, campsite := range ci.campgrounds[key] {
+			campsites[campsiteID] = campsite
+		}
+		for campsiteID, campsite := range result.Availability.Availability.Campsites {
+			campsite.Availabilities = nil
+			campsites[campsiteID] = campsite
+		}
+		ci.campgrounds[key] = campsites
+	}
+}
+
+// Campsites gets the campsites at the campground, asking the provider if we haven't seen it yet
+func (ci *CampsiteIndex) Campsites(ctx context.Context, log *zap.Logger, provider, campgroundID string) (map[string]Campsite, error) {
+	key := campgroundKey(provider, campgroundID)
+
+	ci.mu.Lock()
+	campsites, ok := ci.campgrounds[key]
+	ci.mu.Unlock()
+	if ok {
+		return campsites, nil
+	}
+
+	p, err := ci.providers.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+	fetched, err := p.GetCampsites(ctx, log, campgroundID)
+	if err != nil {
+		return nil, err
+	}
+	// an empty campground is more likely a fetch that didn't finish than a campground without campsites, so
+	// it's asked for again next time rather than remembered
+	if len(fetched) == 0 {
+		return fetched, nil
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	ci.campgrounds[key] = fetched
+	return fetched, nil
+}
+
+// Values lists every distinct value of field across the campsites at the campground, sorted
+func (ci *CampsiteIndex) Values(ctx context.Context, log *zap.Logger, provider, campgroundID string, field func(Campsite) string) ([]string, error) {
+	campsites, err := ci.Campsites(ctx, log, provider, campgroundID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	var values []string
+	for _, campsite := range campsites {
+		value := strings.TrimSpace(field(campsite))
+		if value == "" {
+			continue
+		}
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	return values, nil
+}
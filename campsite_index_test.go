@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+func TestCampsiteIndexValues(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	// camp2 has never been fetched so comes from the provider
+	provider := &fakeProvider{name: "fake", availabilities: map[string]Availability{
+		"camp2": {Campsites: map[string]Campsite{
+			"site1": {CampsiteType: "GROUP TENT"},
+		}},
+	}}
+	ci := NewCampsiteIndex(NewProviderRegistry(provider))
+
+	ci.Update([]AvailabilityResult{
+		{Availability: AvailabilityWithID{Provider: "fake", CampgroundID: "camp1", Availability: Availability{Campsites: map[string]Campsite{
+			"site1": {CampsiteType: "STANDARD NONELECTRIC", TypeOfUse: "Overnight", Availabilities: map[string]string{"2023-06-01T00:00:00Z": StateAvailable}},
+			"site2": {CampsiteType: "RV ELECTRIC", TypeOfUse: "Overnight"},
+			"site3": {CampsiteType: "STANDARD NONELECTRIC", TypeOfUse: "Day"},
+		}}}},
+	})
+
+	types, err := ci.Values(ctx, logger, "fake", "camp1", func(c Campsite) string { return c.CampsiteType })
+	if err != nil {
+		t.Fatalf("Failed to get campsite types: %v", err)
+	}
+	if diff := cmp.Diff([]string{"RV ELECTRIC", "STANDARD NONELECTRIC"}, types); diff != "" {
+		t.Errorf("Types mismatch (-want +got):\n%s", diff)
+	}
+
+	types, err = ci.Values(ctx, logger, "fake", "camp2", func(c Campsite) string { return c.CampsiteType })
+	if err != nil {
+		t.Fatalf("Failed to get campsite types: %v", err)
+	}
+	if diff := cmp.Diff([]string{"GROUP TENT"}, types); diff != "" {
+		t.Errorf("Types from the provider mismatch (-want +got):\n%s", diff)
+	}
+
+	// an empty fetch isn't remembered, so the campground is asked for again once it has campsites
+	_, err = ci.Values(ctx, logger, "fake", "camp3", func(c Campsite) string { return c.CampsiteType })
+	if err != nil {
+		t.Fatalf("Failed to get campsite types: %v", err)
+	}
+	provider.availabilities["camp3"] = Availability{Campsites: map[string]Campsite{
+		"site1": {CampsiteType: "CABIN"},
+	}}
+	types, err = ci.Values(ctx, logger, "fake", "camp3", func(c Campsite) string { return c.CampsiteType })
+	if err != nil {
+		t.Fatalf("Failed to get campsite types: %v", err)
+	}
+	if diff := cmp.Diff([]string{"CABIN"}, types); diff != "" {
+		t.Errorf("Types after an empty fetch mismatch (-want +got):\n%s", diff)
+	}
+
+	// lists complete the last entry and skip what's already picked
+	var suggested []string
+	for _, choice := range suggestValues([]string{"RV ELECTRIC", "STANDARD ELECTRIC", "STANDARD NONELECTRIC"}, "standard nonelectric, elec", true) {
+		suggested = append(suggested, choice.Value.(string))
+	}
+	expected := []string{"standard nonelectric, RV ELECTRIC", "standard nonelectric, STANDARD ELECTRIC"}
+	if diff := cmp.Diff(expected, suggested); diff != "" {
+		t.Errorf("Suggestions mismatch (-want +got):\n%s", diff)
+	}
+}
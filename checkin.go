@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CheckInPreset is a shorthand for a common set of check-in days, along with the nights a stay needs
+type CheckInPreset struct {
+	Days          []time.Weekday
+	MinimumNights int64
+}
+
+// CheckInPresets are the shorthands people can use instead of listing days
+var CheckInPresets = map[string]CheckInPreset{
+	// any night of the weekend
+	"weekends": {Days: []time.Weekday{time.Friday, time.Saturday}, MinimumNights: 1},
+	// the whole weekend, in on friday and out on sunday
+	"fri+sat nights": {Days: []time.Weekday{time.Friday}, MinimumNights: 2},
+}
+
+// parseWeekday reads the full or three letter name of a day
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// ParseCheckInDays reads either a preset or a comma separated list of days, eg "fri, sat" or "friday". It
+// returns the days and the fewest nights a stay starting on them needs, which is zero unless a preset says so.
+func ParseCheckInDays(input string) ([]time.Weekday, int64, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if preset, ok := CheckInPresets[input]; ok {
+		return preset.Days, preset.MinimumNights, nil
+	}
+
+	seen := make(map[time.Weekday]struct{})
+	var days []time.Weekday
+	for _, name := range strings.Split(input, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		day, ok := parseWeekday(name)
+		if !ok {
+			return nil, 0, fmt.Errorf("%s isn't a day of the week or one of: %s", name, strings.Join(checkInPresetNames(), ", "))
+		}
+		if _, ok := seen[day]; ok {
+			continue
+		}
+		seen[day] = struct{}{}
+		days = append(days, day)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i] < days[j]
+	})
+	return days, 0, nil
+}
+
+func checkInPresetNames() []string {
+	names := make([]string, 0, len(CheckInPresets))
+	for name := range CheckInPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkInDaysString lists the days for people to read
+func checkInDaysString(days []time.Weekday) string {
+	if len(days) == 0 {
+		return "Any"
+	}
+	names := make([]string, len(days))
+	for i, day := range days {
+		names[i] = day.String()[:3]
+	}
+	return strings.Join(names, ", ")
+}
+
+// FromCheckIn trims the run to start on the first allowed check-in day that still leaves minimumNights. No
+// days means any day is fine. It returns false if no stay in the run fits.
+func (r ConsecutiveRun) FromCheckIn(days []time.Weekday, minimumNights int) (ConsecutiveRun, bool) {
+	allowed := make(map[time.Weekday]struct{})
+	for _, day := range days {
+		allowed[day] = struct{}{}
+	}
+
+	for start := r.Start; !start.AddDate(0, 0, minimumNights-1).After(r.End); start = start.AddDate(0, 0, 1) {
+		if _, ok := allowed[start.Weekday()]; len(allowed) > 0 && !ok {
+			continue
+		}
+		return ConsecutiveRun{CampsiteID: r.CampsiteID, Start: start, End: r.End}, true
+	}
+
+	return ConsecutiveRun{}, false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCheckInDays(t *testing.T) {
+	testCases := []struct {
+		input          string
+		expectedDays   []time.Weekday
+		expectedNights int64
+		expectErr      bool
+	}{
+		{input: "Weekends", expectedDays: []time.Weekday{time.Friday, time.Saturday}, expectedNights: 1},
+		{input: "fri+sat nights", expectedDays: []time.Weekday{time.Friday}, expectedNights: 2},
+		{input: "sat, Friday,fri", expectedDays: []time.Weekday{time.Friday, time.Saturday}},
+		{input: "fridays", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			days, nights, err := ParseCheckInDays(tc.input)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", days)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to parse check-in days: %v", err)
+			}
+			if diff := cmp.Diff(tc.expectedDays, days); diff != "" {
+				t.Errorf("Days mismatch (-want +got):\n%s", diff)
+			}
+			if nights != tc.expectedNights {
+				t.Errorf("Expected %d nights, got %d", tc.expectedNights, nights)
+			}
+		})
+	}
+}
+
+func TestSchniffMinimumNights(t *testing.T) {
+	// fri+sat nights needs two nights on top of whatever minimum was asked for
+	_, checkInNights, err := ParseCheckInDays("fri+sat nights")
+	if err != nil {
+		t.Fatalf("Failed to parse preset: %v", err)
+	}
+	schniff := &Schniff{MinimumConsecutiveDays: 1, CheckInNights: checkInNights}
+	if nights := schniff.MinimumNights(); nights != 2 {
+		t.Errorf("Expected the preset to need 2 nights, got %d", nights)
+	}
+
+	// removing the preset goes back to the minimum from before it
+	schniff.CheckInNights = 0
+	if nights := schniff.MinimumNights(); nights != 1 {
+		t.Errorf("Expected 1 night without the preset, got %d", nights)
+	}
+
+	schniff = &Schniff{MinimumConsecutiveDays: 3, CheckInNights: checkInNights}
+	if nights := schniff.MinimumNights(); nights != 3 {
+		t.Errorf("Expected the longer minimum to win, got %d", nights)
+	}
+	if nights := (&Schniff{}).MinimumNights(); nights != 1 {
+		t.Errorf("Expected at least 1 night, got %d", nights)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Config holds everything schniffbot reads from the environment at startup
+type Config struct {
+	BotToken string
+	GuildID  string
+
+	// SchniffStore picks the backend schniffs are stored in, either json or bolt
+	SchniffStore    string
+	SchniffJSONFile string
+	SchniffBoltFile string
+	// SchniffArchiveJSONFile and SchniffArchiveBoltFile hold the schniffs that are over, in the same backend
+	SchniffArchiveJSONFile string
+	SchniffArchiveBoltFile string
+
+	NotificationRecordsFile string
+	RecordRetention         RecordRetention
+	SnapshotFile            string
+	// TransitionRetention is how long the transitions heatmaps are built from are kept
+	TransitionRetention time.Duration
+	// NotificationCooldown is the least time between notifications to the same user
+	NotificationCooldown time.Duration
+
+	// PollInterval is how often a cycle of availability requests starts
+	PollInterval time.Duration
+	Fetch        FetchConfig
+	Schedule     SchedulerConfig
+	Release      ReleaseConfig
+	Lifecycle    LifecycleConfig
+	Catalog      CampsiteCatalogConfig
+	Delivery     DeliveryConfig
+	// SMTP is the mail server email notifications go through. Email notifications are off without a host.
+	SMTP SMTPConfig
+}
+
+// LoadConfig reads the config from environment variables, falling back to defaults where they're not set
+func LoadConfig() (Config, error) {
+	config := Config{
+		BotToken:                os.Getenv("BOT_TOKEN"),
+		GuildID:                 os.Getenv("GUILD_ID"),
+		SchniffStore:            envString("SCHNIFF_STORE", SchniffStoreJSON),
+		SchniffJSONFile:         envString("SCHNIFF_JSON_FILE", filepath.Join(SchniffDir, "schniffs.json")),
+		SchniffBoltFile:         envString("SCHNIFF_BOLT_FILE", filepath.Join(SchniffDir, "schniffs.db")),
+		SchniffArchiveJSONFile:  envString("SCHNIFF_ARCHIVE_JSON_FILE", filepath.Join(SchniffDir, "archived_schniffs.json")),
+		SchniffArchiveBoltFile:  envString("SCHNIFF_ARCHIVE_BOLT_FILE", filepath.Join(SchniffDir, "archived_schniffs.db")),
+		NotificationRecordsFile: envString("NOTIFICATION_RECORDS_FILE", filepath.Join(SchniffDir, "notification_records.json")),
+		SnapshotFile:            envString("SNAPSHOT_FILE", filepath.Join(SchniffDir, "snapshots.db")),
+		Lifecycle: LifecycleConfig{
+			Timezone: envString("LIFECYCLE_TIMEZONE", HeatmapLocation),
+		},
+		Catalog: CampsiteCatalogConfig{
+			File: envString("CAMPSITE_DETAILS_FILE", filepath.Join(SchniffDir, "campsite_details.json")),
+		},
+		Delivery: DeliveryConfig{
+			PreferencesFile: envString("PREFERENCES_FILE", filepath.Join(SchniffDir, "preferences.json")),
+			Channel:         envString("NOTIFICATION_CHANNEL", "schniffs"),
+		},
+		SMTP: SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     envString("SMTP_FROM", "schniffbot@localhost"),
+		},
+		Release: ReleaseConfig{
+			WindowsFile:   envString("RELEASE_WINDOWS_FILE", filepath.Join(SchniffDir, "release_windows.json")),
+			RemindersFile: envString("RELEASE_REMINDERS_FILE", filepath.Join(SchniffDir, "release_reminders.json")),
+		},
+	}
+
+	var err error
+	config.RecordRetention.PastDateGrace, err = envDuration("NOTIFICATION_RECORDS_PAST_DATE_GRACE", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	config.RecordRetention.KeepStoppedSchniffs, err = envBool("NOTIFICATION_RECORDS_KEEP_STOPPED", false)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config.NotificationCooldown, err = envDuration("NOTIFICATION_COOLDOWN", 2*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config.TransitionRetention, err = envDuration("TRANSITION_RETENTION", 365*24*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config.PollInterval, err = envDuration("POLL_INTERVAL", 15*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+	if config.PollInterval <= 0 {
+		return Config{}, fmt.Errorf("POLL_INTERVAL must be positive, got %s", config.PollInterval)
+	}
+	config.Fetch.Concurrency, err = envInt("FETCH_CONCURRENCY", 8)
+	if err != nil {
+		return Config{}, err
+	}
+	// leave some of the interval free for everything that happens after the requests
+	config.Fetch.Spread, err = envDuration("FETCH_SPREAD", config.PollInterval*2/3)
+	if err != nil {
+		return Config{}, err
+	}
+	if config.Fetch.Spread < 0 {
+		return Config{}, fmt.Errorf("FETCH_SPREAD can't be negative, got %s", config.Fetch.Spread)
+	}
+
+	config.Schedule.MinInterval, err = envDuration("SCHEDULE_MIN_INTERVAL", config.PollInterval)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Schedule.MaxInterval, err = envDuration("SCHEDULE_MAX_INTERVAL", 30*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	if config.Schedule.MinInterval <= 0 {
+		return Config{}, fmt.Errorf("SCHEDULE_MIN_INTERVAL must be positive, got %s", config.Schedule.MinInterval)
+	}
+	if config.Schedule.MaxInterval < config.Schedule.MinInterval {
+		return Config{}, fmt.Errorf("SCHEDULE_MAX_INTERVAL %s is less than SCHEDULE_MIN_INTERVAL %s", config.Schedule.MaxInterval, config.Schedule.MinInterval)
+	}
+	config.Schedule.RequestsPerHour, err = envInt("REQUESTS_PER_HOUR", 3600)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Schedule.CancellationWindow, err = envDuration("CANCELLATION_WINDOW", 24*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config.Release.ReminderLead, err = envDuration("RELEASE_REMINDER_LEAD", time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Release.BoostBefore, err = envDuration("RELEASE_BOOST_BEFORE", 2*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Release.BoostAfter, err = envDuration("RELEASE_BOOST_AFTER", 10*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config.Lifecycle.Interval, err = envDuration("LIFECYCLE_INTERVAL", time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+	if config.Lifecycle.Interval <= 0 {
+		return Config{}, fmt.Errorf("LIFECYCLE_INTERVAL must be positive, got %s", config.Lifecycle.Interval)
+	}
+
+	config.Delivery.UrgentWithin, err = envDuration("URGENT_WITHIN", 48*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config.SMTP.Port, err = envInt("SMTP_PORT", 587)
+	if err != nil {
+		return Config{}, err
+	}
+	config.SMTP.Timeout, err = envDuration("SMTP_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+	if config.SMTP.Timeout <= 0 {
+		return Config{}, fmt.Errorf("SMTP_TIMEOUT must be positive, got %s", config.SMTP.Timeout)
+	}
+
+	config.Catalog.MaxAge, err = envDuration("CAMPSITE_DETAILS_MAX_AGE", 7*24*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Catalog.Interval, err = envDuration("CAMPSITE_DETAILS_INTERVAL", 15*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	if config.Catalog.Interval <= 0 {
+		return Config{}, fmt.Errorf("CAMPSITE_DETAILS_INTERVAL must be positive, got %s", config.Catalog.Interval)
+	}
+
+	return config, nil
+}
+
+func envString(name, fallback string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration for %s: %w", name, err)
+	}
+	return duration, nil
+}
+
+func envBool(name string, fallback bool) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid bool for %s: %w", name, err)
+	}
+	return b, nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid int for %s: %w", name, err)
+	}
+	return i, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load default config: %v", err)
+	}
+	if config.PollInterval != 15*time.Second {
+		t.Errorf("Expected a 15s poll interval, got %s", config.PollInterval)
+	}
+	if config.Fetch.Spread != 10*time.Second {
+		t.Errorf("Expected the spread to default to 2/3 of the poll interval, got %s", config.Fetch.Spread)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for name, env := range map[string]map[string]string{
+		"zero poll interval":             {"POLL_INTERVAL": "0s"},
+		"negative poll interval":         {"POLL_INTERVAL": "-1s"},
+		"negative spread":                {"FETCH_SPREAD": "-1s"},
+		"bad duration":                   {"POLL_INTERVAL": "soon"},
+		"zero min interval":              {"SCHEDULE_MIN_INTERVAL": "0s"},
+		"max below min interval":         {"SCHEDULE_MIN_INTERVAL": "10m", "SCHEDULE_MAX_INTERVAL": "5m"},
+		"zero lifecycle interval":        {"LIFECYCLE_INTERVAL": "0s"},
+		"zero campsite details interval": {"CAMPSITE_DETAILS_INTERVAL": "0s"},
+		"zero smtp timeout":              {"SMTP_TIMEOUT": "0s"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			_, err := LoadConfig()
+			if err == nil {
+				t.Errorf("Expected an error loading config with %v", env)
+			}
+		})
+	}
+}
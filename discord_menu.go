@@ -10,6 +10,10 @@ const (
 	CommandViewSchniffs   = "view-schniffs"
 	CommandRestartSchniff = "restart-schniff"
 	CommandStopSchniff    = "stop-schniff"
+	CommandEditSchniff    = "edit-schniff"
+	CommandDeleteSchniff  = "delete-schniff"
+	CommandHeatmap        = "heatmap"
+	CommandPreferences    = "preferences"
 )
 
 var (
@@ -54,12 +58,98 @@ var (
 					Required:     false,
 					Autocomplete: false,
 				},
+				{
+					Name:         "check-in-days",
+					Description:  "Days a stay can start on (eg fri,sat), or weekends, or fri+sat nights",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "stay-length",
+					Description:  "Look for any stay of exactly this many nights between start and end",
+					Type:         discordgo.ApplicationCommandOptionInteger,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "party-size",
+					Description:  "How many people are going, to leave out campsites that don't fit them",
+					Type:         discordgo.ApplicationCommandOptionInteger,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "include-types",
+					Description:  "Only these campsite types (separated by comma)",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:         "exclude-types",
+					Description:  "Never these campsite types (separated by comma)",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:         "use-type",
+					Description:  "Only campsites for this use, eg Overnight",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:         "loops",
+					Description:  "Only campsites in these loops (separated by comma)",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:         "vehicle-length",
+					Description:  "Only campsites that fit a vehicle this long, in feet",
+					Type:         discordgo.ApplicationCommandOptionInteger,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "accessible",
+					Description:  "Only accessible campsites",
+					Type:         discordgo.ApplicationCommandOptionBoolean,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "pets",
+					Description:  "Only campsites that allow pets",
+					Type:         discordgo.ApplicationCommandOptionBoolean,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "email",
+					Description:  "Also email notifications to this address",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
 			},
 		},
 		{
 			Name:        CommandViewSchniffs,
 			Description: "See all schniffs belonging to you.",
 			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "archived",
+					Description:  "Show schniffs that are over instead",
+					Type:         discordgo.ApplicationCommandOptionBoolean,
+					Required:     false,
+					Autocomplete: false,
+				},
+			},
 		},
 		{
 			Name:        CommandRestartSchniff,
@@ -89,25 +179,218 @@ var (
 				},
 			},
 		},
+		{
+			Name:        CommandEditSchniff,
+			Description: "Change the dates or campsites of a schniff",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "schniff-id",
+					Description:  "Schniff",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
+				},
+				{
+					Name:         "start",
+					Description:  "Start (YYYY-MM-DD)",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "end",
+					Description:  "End (YYYY-MM-DD)",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "campsite-list",
+					Description:  "List of campsite IDs (separated by comma), or all",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "minimum-consecutive-days",
+					Description:  "Minimum number of consecutive available days required to trigger a notification.",
+					Type:         discordgo.ApplicationCommandOptionInteger,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "check-in-days",
+					Description:  "Days a stay can start on (eg fri,sat), or weekends, fri+sat nights, or any",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "stay-length",
+					Description:  "Look for any stay of exactly this many nights between start and end, 0 to turn off",
+					Type:         discordgo.ApplicationCommandOptionInteger,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "party-size",
+					Description:  "How many people are going, to leave out campsites that don't fit them, 0 for any",
+					Type:         discordgo.ApplicationCommandOptionInteger,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "include-types",
+					Description:  "Only these campsite types (separated by comma), or all",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:         "exclude-types",
+					Description:  "Never these campsite types (separated by comma), or none",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:         "use-type",
+					Description:  "Only campsites for this use, eg Overnight, or any",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:         "loops",
+					Description:  "Only campsites in these loops (separated by comma), or all",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:         "vehicle-length",
+					Description:  "Only campsites that fit a vehicle this long, in feet, or 0 for any",
+					Type:         discordgo.ApplicationCommandOptionInteger,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "accessible",
+					Description:  "Only accessible campsites",
+					Type:         discordgo.ApplicationCommandOptionBoolean,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "pets",
+					Description:  "Only campsites that allow pets",
+					Type:         discordgo.ApplicationCommandOptionBoolean,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "email",
+					Description:  "Also email notifications to this address, or off",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
+			},
+		},
+		{
+			Name:        CommandDeleteSchniff,
+			Description: "Delete a schniff for good",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "schniff-id",
+					Description:  "Schniff",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
+				},
+			},
+		},
+		{
+			Name:        CommandHeatmap,
+			Description: "See when cancellations show up at a campground",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "campground",
+					Description:  "Campground Name",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
+				},
+			},
+		},
+		{
+			Name:        CommandPreferences,
+			Description: "See or change how you hear about your schniffs",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "timezone",
+					Description:  "Timezone for quiet hours, eg America/Los_Angeles",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "quiet-start",
+					Description:  "When quiet hours start (HH:MM), or off",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:         "quiet-end",
+					Description:  "When quiet hours end (HH:MM), or off",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: false,
+				},
+				{
+					Name:        "delivery",
+					Description: "Where notifications go",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "DM", Value: DeliveryDM},
+						{Name: "Channel", Value: DeliveryChannel},
+						{Name: "Both", Value: DeliveryBoth},
+					},
+				},
+				{
+					Name:         "mention-in-announcements",
+					Description:  "Whether to mention you in the announcement when you get a notification",
+					Type:         discordgo.ApplicationCommandOptionBoolean,
+					Required:     false,
+					Autocomplete: false,
+				},
+			},
+		},
 	}
 
-	commandHandlers = map[string]func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection){
-		CommandViewSchniffs: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection) {
+	commandHandlers = map[string]func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry, ss *SnapshotStore, ci *CampsiteIndex, ps *PreferenceStore){
+		CommandViewSchniffs: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry, ss *SnapshotStore, ci *CampsiteIndex, ps *PreferenceStore) {
 			switch i.Type {
 			case discordgo.InteractionApplicationCommand:
-				HandleViewSchniffs(log, s, i, sc)
+				HandleViewSchniffs(log, s, i, sc, providers)
 
 			}
 		},
-		CommandNewSchniff: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection) {
+		CommandNewSchniff: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry, ss *SnapshotStore, ci *CampsiteIndex, ps *PreferenceStore) {
 			switch i.Type {
 			case discordgo.InteractionApplicationCommand:
-				HandleNewSchniff(log, s, i, sc, cc)
+				HandleNewSchniff(log, s, i, sc, cc, providers)
 			case discordgo.InteractionApplicationCommandAutocomplete:
-				HandleNewSchniffAutocomplete(log, s, i, sc, cc)
+				HandleNewSchniffAutocomplete(log, s, i, sc, cc, ci)
 			}
 		},
-		CommandRestartSchniff: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection) {
+		CommandRestartSchniff: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry, ss *SnapshotStore, ci *CampsiteIndex, ps *PreferenceStore) {
 			switch i.Type {
 			case discordgo.InteractionApplicationCommand:
 				HandleRestartSchniff(log, s, i, sc)
@@ -115,7 +398,7 @@ var (
 				HandleRestartSchniffAutocomplete(log, s, i, sc)
 			}
 		},
-		CommandStopSchniff: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection) {
+		CommandStopSchniff: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry, ss *SnapshotStore, ci *CampsiteIndex, ps *PreferenceStore) {
 			switch i.Type {
 			case discordgo.InteractionApplicationCommand:
 				HandleStopSchniff(log, s, i, sc)
@@ -123,5 +406,35 @@ var (
 				HandleStopSchniffAutocomplete(log, s, i, sc)
 			}
 		},
+		CommandEditSchniff: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry, ss *SnapshotStore, ci *CampsiteIndex, ps *PreferenceStore) {
+			switch i.Type {
+			case discordgo.InteractionApplicationCommand:
+				HandleEditSchniff(log, s, i, sc, providers)
+			case discordgo.InteractionApplicationCommandAutocomplete:
+				HandleEditSchniffAutocomplete(log, s, i, sc, ci)
+			}
+		},
+		CommandDeleteSchniff: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry, ss *SnapshotStore, ci *CampsiteIndex, ps *PreferenceStore) {
+			switch i.Type {
+			case discordgo.InteractionApplicationCommand:
+				HandleDeleteSchniff(log, s, i, sc)
+			case discordgo.InteractionApplicationCommandAutocomplete:
+				HandleDeleteSchniffAutocomplete(log, s, i, sc)
+			}
+		},
+		CommandHeatmap: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry, ss *SnapshotStore, ci *CampsiteIndex, ps *PreferenceStore) {
+			switch i.Type {
+			case discordgo.InteractionApplicationCommand:
+				HandleHeatmap(log, s, i, cc, ss)
+			case discordgo.InteractionApplicationCommandAutocomplete:
+				HandleHeatmapAutocomplete(log, s, i, cc)
+			}
+		},
+		CommandPreferences: func(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry, ss *SnapshotStore, ci *CampsiteIndex, ps *PreferenceStore) {
+			switch i.Type {
+			case discordgo.InteractionApplicationCommand:
+				HandlePreferences(log, s, i, ps)
+			}
+		},
 	}
 )
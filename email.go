@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SMTPConfig is the mail server email notifications are sent through
+type SMTPConfig struct {
+	Host string
+	Port int
+	// Username and Password authenticate with the server, which is skipped if Username is empty
+	Username string
+	Password string
+	// From is the address emails come from
+	From string
+	// Timeout is how long sending an email can take altogether, so a mail server that hangs doesn't hold
+	// up polling
+	Timeout time.Duration
+}
+
+// ParseEmail checks the address is an email address, eg "Schniffer <a@b.com>", and gives just the address
+func ParseEmail(value string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(value))
+	if err != nil {
+		return "", err
+	}
+	return address.Address, nil
+}
+
+// MaskEmail hides most of the address, eg j***@example.com, since schniffs are shown in channels everyone can
+// read
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return email
+	}
+	// keep the whole first character, not just its first byte
+	_, size := utf8.DecodeRuneInString(local)
+	return local[:size] + "***@" + domain
+}
+
+// EmailNotifier sends notifications as a plain text email to the schniffs that opted in with an Email
+type EmailNotifier struct {
+	config    SMTPConfig
+	sc        *SchniffCollection
+	providers ProviderRegistry
+}
+
+func NewEmailNotifier(config SMTPConfig, sc *SchniffCollection, providers ProviderRegistry) *EmailNotifier {
+	return &EmailNotifier{
+		config:    config,
+		sc:        sc,
+		providers: providers,
+	}
+}
+
+func (en *EmailNotifier) Name() string {
+	return "email"
+}
+
+func (en *EmailNotifier) Enabled(schniff *Schniff) bool {
+	return schniff.Email != ""
+}
+
+func (en *EmailNotifier) Notify(schniff *Schniff, notification Notification) error {
+	subject, body, err := GenerateEmailMessage(en.sc, en.providers, notification)
+	if err != nil {
+		return err
+	}
+
+	message := buildEmail(en.config.From, schniff.Email, subject, body, time.Now())
+	return en.send(schniff.Email, message)
+}
+
+// send is smtp.SendMail with a deadline on the whole conversation, which SendMail doesn't have
+func (en *EmailNotifier) send(to string, message []byte) error {
+	address := net.JoinHostPort(en.config.Host, strconv.Itoa(en.config.Port))
+	conn, err := net.DialTimeout("tcp", address, en.config.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(en.config.Timeout))
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, en.config.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: en.config.Host})
+		if err != nil {
+			return err
+		}
+	}
+	if en.config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", en.config.Username, en.config.Password, en.config.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(en.config.From)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(message)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// buildEmail puts the headers on a plain text email
+func buildEmail(from, to, subject, body string, date time.Time) []byte {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	builder.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	// campground names aren't always ascii
+	builder.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject)))
+	builder.WriteString(fmt.Sprintf("Date: %s\r\n", date.Format(time.RFC1123Z)))
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	builder.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(builder.String())
+}
+
+// GenerateEmailMessage renders the notification as the subject and plain text body of an email. It lists the
+// same campsites as the discord embed.
+func GenerateEmailMessage(sc *SchniffCollection, providers ProviderRegistry, notification Notification) (string, string, error) {
+	schniff, err := sc.GetSchniff(notification.SchniffID)
+	if err != nil {
+		return "", "", err
+	}
+
+	provider, err := providers.Get(schniff.Provider)
+	if err != nil {
+		return "", "", err
+	}
+
+	subject := fmt.Sprintf("Campsites available at %s, %s to %s",
+		schniff.CampgroundName,
+		schniff.StartDate.Format("2006-01-02"),
+		schniff.EndDate.Format("2006-01-02"),
+	)
+
+	totalDays := int(schniff.EndDate.Sub(schniff.StartDate).Hours()/24) + 1
+	campsites, totalCampsites := SummariseCampsites(notification, 10)
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Hi %s,\n\n", schniff.UserNick))
+	builder.WriteString(fmt.Sprintf("%s I just schniffed some available campsites at %s between %s and %s.\n",
+		RandomSillyHeader(),
+		schniff.CampgroundName,
+		schniff.StartDate.Format("2006-01-02"),
+		schniff.EndDate.Format("2006-01-02"),
+	))
+	builder.WriteString(fmt.Sprintf("Showing the top %d campsites by days available, listed as %s.\n", len(campsites), stayDescription(schniff, notification)))
+	builder.WriteString(fmt.Sprintf("%d total campsites with availabilities.\n", totalCampsites))
+
+	for i, campsite := range campsites {
+		if campsite.Loop != "" && (i == 0 || campsites[i-1].Loop != campsite.Loop) {
+			builder.WriteString(fmt.Sprintf("\n== Loop %s (%s) ==\n", campsite.Loop, campsite.LoopSummary))
+		}
+
+		builder.WriteString(fmt.Sprintf("\n%s\n", campsite.Name))
+		builder.WriteString(fmt.Sprintf("%d of %d days available\n", campsite.DaysCount, totalDays))
+		if campsite.Details != "" {
+			builder.WriteString(campsite.Details + "\n")
+		}
+		for j, line := range campsite.Lines {
+			if j == 10 {
+				builder.WriteString(fmt.Sprintf("...and %d more\n", len(campsite.Lines)-j))
+				break
+			}
+			builder.WriteString(line + "\n")
+		}
+		builder.WriteString(fmt.Sprintf("Book: %s\n", provider.CampsiteURL(schniff.CampgroundID, campsite.CampsiteID)))
+	}
+
+	builder.WriteString("\nRemember\n")
+	builder.WriteString(reminders(provider) + "\n")
+
+	return subject, builder.String(), nil
+}
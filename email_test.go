@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type sinkEmail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpSink is a local SMTP server that accepts every email without auth and keeps it
+type smtpSink struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	emails []sinkEmail
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	sink := &smtpSink{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go sink.serve(conn)
+		}
+	}()
+	return sink
+}
+
+func (sink *smtpSink) config() SMTPConfig {
+	host, port, _ := net.SplitHostPort(sink.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return SMTPConfig{Host: host, Port: portNumber, From: "schniffbot@localhost", Timeout: 5 * time.Second}
+}
+
+func (sink *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP sink")
+
+	var email sinkEmail
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			text.PrintfLine("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			email = sinkEmail{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			email.to = append(email.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			text.PrintfLine("250 OK")
+		case command == "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			email.data = string(data)
+			sink.mu.Lock()
+			sink.emails = append(sink.emails, email)
+			sink.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case command == "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (sink *smtpSink) received() []sinkEmail {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return append([]sinkEmail(nil), sink.emails...)
+}
+
+func TestEmailNotifier(t *testing.T) {
+	sink := newSMTPSink(t)
+	day := func(d int) time.Time { return time.Date(2023, 8, d, 0, 0, 0, 0, time.UTC) }
+
+	schniff := &Schniff{
+		SchniffID:              "schniff1",
+		Active:                 true,
+		Provider:               ProviderRecreationGov,
+		CampgroundID:           "232447",
+		CampgroundName:         "Upper Pines",
+		StartDate:              day(1),
+		EndDate:                day(10),
+		UserID:                 "user1",
+		UserNick:               "JohnDoe",
+		MinimumConsecutiveDays: 1,
+		Email:                  "john@example.com",
+	}
+	sc := newTestSchniffCollection(t, schniff)
+	notification := Notification{
+		SchniffID: "schniff1",
+		AvailableCampsites: []CampsiteAvailability{
+			{CampsiteID: "71047", Site: "018", Loop: "North", Date: day(4)},
+			{CampsiteID: "71047", Site: "018", Loop: "North", Date: day(5)},
+			{CampsiteID: "71048", Site: "019", Loop: "North", Date: day(7)},
+		},
+	}
+
+	notifier := NewEmailNotifier(sink.config(), sc, testProviders())
+	if !notifier.Enabled(schniff) {
+		t.Fatal("Expected email to be enabled for a schniff with an email")
+	}
+	if notifier.Enabled(&Schniff{}) {
+		t.Error("Expected email to be disabled for a schniff without an email")
+	}
+
+	err := notifier.Notify(schniff, notification)
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	emails := sink.received()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+	if emails[0].from != "schniffbot@localhost" || len(emails[0].to) != 1 || emails[0].to[0] != "john@example.com" {
+		t.Errorf("Unexpected envelope: from %s to %v", emails[0].from, emails[0].to)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(emails[0].data))
+	if err != nil {
+		t.Fatalf("Failed to read email: %v", err)
+	}
+	if subject := message.Header.Get("Subject"); subject != "Campsites available at Upper Pines, 2023-08-01 to 2023-08-10" {
+		t.Errorf("Unexpected subject: %s", subject)
+	}
+	body, err := io.ReadAll(message.Body)
+	if err != nil {
+		t.Fatalf("Failed to read email body: %v", err)
+	}
+	for _, want := range []string{
+		"Hi JohnDoe,",
+		"== Loop North (2 campsites) ==",
+		"Site 018 (Loop North)\n2 of 10 days available",
+		"Friday (2023-08-04), 2 nights",
+		"Book: https://www.recreation.gov/camping/campsites/71047",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected email body to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestParseEmail(t *testing.T) {
+	email, err := ParseEmail(" Schniffer <schniffer@example.com> ")
+	if err != nil || email != "schniffer@example.com" {
+		t.Errorf("Expected schniffer@example.com, got %s, %v", email, err)
+	}
+	_, err = ParseEmail("not an email")
+	if err == nil {
+		t.Error("Expected an error for an invalid email")
+	}
+}
+
+func TestMaskEmail(t *testing.T) {
+	for email, expected := range map[string]string{
+		"schniffer@example.com": "s***@example.com",
+		"a@b.com":               "a***@b.com",
+		"élodie@example.com":    "é***@example.com",
+		"":                      "",
+	} {
+		if masked := MaskEmail(email); masked != expected {
+			t.Errorf("Expected %q to be masked as %q, got %q", email, expected, masked)
+		}
+	}
+}
+
+// fakeNotifier records what it was asked to send, failing if it has an error
+type fakeNotifier struct {
+	enabled bool
+	err     error
+	sent    []string
+}
+
+func (fn *fakeNotifier) Name() string {
+	return "fake"
+}
+
+func (fn *fakeNotifier) Enabled(schniff *Schniff) bool {
+	return fn.enabled
+}
+
+func (fn *fakeNotifier) Notify(schniff *Schniff, notification Notification) error {
+	if fn.err != nil {
+		return fn.err
+	}
+	fn.sent = append(fn.sent, notification.SchniffID)
+	return nil
+}
+
+func TestNotifyAll(t *testing.T) {
+	logger := zap.NewNop()
+	schniff := &Schniff{SchniffID: "schniff1"}
+	notification := Notification{SchniffID: "schniff1"}
+
+	broken := &fakeNotifier{enabled: true, err: errors.New("connection refused")}
+	working := &fakeNotifier{enabled: true}
+	disabled := &fakeNotifier{enabled: false}
+
+	if !NotifyAll(logger, []Notifier{broken, working, disabled}, schniff, notification) {
+		t.Error("Expected the notification to count as sent when one notifier worked")
+	}
+	if len(working.sent) != 1 || len(disabled.sent) != 0 {
+		t.Errorf("Expected only the enabled notifier to send, got %v and %v", working.sent, disabled.sent)
+	}
+
+	if NotifyAll(logger, []Notifier{broken, disabled}, schniff, notification) {
+		t.Error("Expected the notification not to count as sent when nothing worked")
+	}
+}
+
+func TestEmailNotifierNoServer(t *testing.T) {
+	sink := newSMTPSink(t)
+	config := sink.config()
+	sink.listener.Close()
+
+	schniff := &Schniff{SchniffID: "schniff1", Provider: ProviderRecreationGov, Email: "john@example.com"}
+	sc := newTestSchniffCollection(t, schniff)
+	err := NewEmailNotifier(config, sc, testProviders()).Notify(schniff, Notification{SchniffID: "schniff1"})
+	if err == nil {
+		t.Error("Expected an error with no mail server")
+	}
+}
+
+func TestEmailNotifierTimeout(t *testing.T) {
+	// a mail server that accepts the connection and then never says anything
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	config := SMTPConfig{Host: host, Port: portNumber, From: "schniffbot@localhost", Timeout: 100 * time.Millisecond}
+
+	schniff := &Schniff{SchniffID: "schniff1", Provider: ProviderRecreationGov, Email: "john@example.com"}
+	sc := newTestSchniffCollection(t, schniff)
+
+	start := time.Now()
+	err = NewEmailNotifier(config, sc, testProviders()).Notify(schniff, Notification{SchniffID: "schniff1"})
+	if err == nil {
+		t.Error("Expected an error from a mail server that hangs")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the timeout to cut the email off, took %s", elapsed)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CampgroundFailure describes a campground that we couldn't get availability for
+type CampgroundFailure struct {
+	Provider     string
+	CampgroundID string
+	Since        time.Time
+	Err          string
+}
+
+// FailureReporter keeps track of which campgrounds are failing so that each is reported once when it starts
+// failing, and once when it recovers, rather than every cycle
+type FailureReporter struct {
+	mu      sync.Mutex
+	failing map[string]CampgroundFailure
+}
+
+func NewFailureReporter() *FailureReporter {
+	return &FailureReporter{
+		failing: make(map[string]CampgroundFailure),
+	}
+}
+
+// Update takes the results from a cycle and returns the campgrounds that have started failing, and the ones
+// that were failing but are working again. A campground is failing if any of its requests failed, and has
+// recovered once all of its requests succeed. Campgrounds that weren't requested are left as they were.
+func (fr *FailureReporter) Update(results []AvailabilityResult, now time.Time) (newFailures []CampgroundFailure, recovered []CampgroundFailure) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	cycleFailures := make(map[string]CampgroundFailure)
+	requested := make(map[string]struct{})
+	for _, result := range results {
+		key := failureKey(result.Request)
+		requested[key] = struct{}{}
+		if result.Err == nil {
+			continue
+		}
+		if _, ok := cycleFailures[key]; ok {
+			continue
+		}
+		cycleFailures[key] = CampgroundFailure{
+			Provider:     providerOrDefault(result.Request.Provider),
+			CampgroundID: result.Request.CampgroundID,
+			Since:        now,
+			Err:          result.Err.Error(),
+		}
+	}
+
+	for key := range requested {
+		failure, failedNow := cycleFailures[key]
+		previous, failedBefore := fr.failing[key]
+		switch {
+		case failedNow && !failedBefore:
+			fr.failing[key] = failure
+			newFailures = append(newFailures, failure)
+		case !failedNow && failedBefore:
+			delete(fr.failing, key)
+			recovered = append(recovered, previous)
+		}
+	}
+
+	sortFailures(newFailures)
+	sortFailures(recovered)
+
+	return newFailures, recovered
+}
+
+// Failing returns every campground that is currently failing
+func (fr *FailureReporter) Failing() []CampgroundFailure {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	failures := make([]CampgroundFailure, 0, len(fr.failing))
+	for _, failure := range fr.failing {
+		failures = append(failures, failure)
+	}
+	sortFailures(failures)
+
+	return failures
+}
+
+// FormatFailureReport groups the failures and recoveries into a single message for the problemos channel.
+// It returns an empty string if there is nothing to say.
+func FormatFailureReport(newFailures, recovered []CampgroundFailure) string {
+	var sb strings.Builder
+	if len(newFailures) > 0 {
+		sb.WriteString(fmt.Sprintf("Unable to get availability for %d campgrounds:\n", len(newFailures)))
+		for _, failure := range newFailures {
+			sb.WriteString(fmt.Sprintf("- %s %s: %s\n", failure.Provider, failure.CampgroundID, failure.Err))
+		}
+	}
+	if len(recovered) > 0 {
+		sb.WriteString(fmt.Sprintf("Availability is working again for %d campgrounds:\n", len(recovered)))
+		for _, failure := range recovered {
+			sb.WriteString(fmt.Sprintf("- %s %s (failing since %s)\n", failure.Provider, failure.CampgroundID, failure.Since.Format(time.RFC3339)))
+		}
+	}
+	return sb.String()
+}
+
+func failureKey(request AvailabilityRequest) string {
+	return providerOrDefault(request.Provider) + "/" + request.CampgroundID
+}
+
+func sortFailures(failures []CampgroundFailure) {
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Provider != failures[j].Provider {
+			return failures[i].Provider < failures[j].Provider
+		}
+		return failures[i].CampgroundID < failures[j].CampgroundID
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailureReporter(t *testing.T) {
+	fr := NewFailureReporter()
+	now := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	broken := func(campgroundID string, month time.Month) AvailabilityResult {
+		return AvailabilityResult{
+			Request: AvailabilityRequest{CampgroundID: campgroundID, TargetTime: time.Date(2023, month, 1, 0, 0, 0, 0, time.UTC)},
+			Err:     fmt.Errorf("Got bad status code: 500"),
+		}
+	}
+	working := func(campgroundID string, month time.Month) AvailabilityResult {
+		return AvailabilityResult{
+			Request: AvailabilityRequest{CampgroundID: campgroundID, TargetTime: time.Date(2023, month, 1, 0, 0, 0, 0, time.UTC)},
+		}
+	}
+
+	// two months failing at the same campground should be reported once
+	newFailures, recovered := fr.Update([]AvailabilityResult{broken("camp1", 8), broken("camp1", 9), working("camp2", 8)}, now)
+	if len(newFailures) != 1 || newFailures[0].CampgroundID != "camp1" || len(recovered) != 0 {
+		t.Fatalf("Expected camp1 to be reported as failing once, got %+v %+v", newFailures, recovered)
+	}
+	report := FormatFailureReport(newFailures, recovered)
+	if !strings.Contains(report, "recreation.gov camp1") {
+		t.Errorf("Expected report to mention camp1, got %s", report)
+	}
+
+	// still failing next cycle, nothing new to say
+	newFailures, recovered = fr.Update([]AvailabilityResult{working("camp1", 8), broken("camp1", 9), broken("camp2", 8)}, now.Add(time.Minute))
+	if len(newFailures) != 1 || newFailures[0].CampgroundID != "camp2" || len(recovered) != 0 {
+		t.Fatalf("Expected only camp2 to be newly failing, got %+v %+v", newFailures, recovered)
+	}
+
+	// not requesting a campground shouldn't count as recovering
+	newFailures, recovered = fr.Update([]AvailabilityResult{broken("camp2", 8)}, now.Add(2*time.Minute))
+	if len(newFailures) != 0 || len(recovered) != 0 {
+		t.Fatalf("Expected nothing to report, got %+v %+v", newFailures, recovered)
+	}
+	if len(fr.Failing()) != 2 {
+		t.Errorf("Expected 2 failing campgrounds, got %d", len(fr.Failing()))
+	}
+
+	newFailures, recovered = fr.Update([]AvailabilityResult{working("camp1", 8), working("camp1", 9)}, now.Add(3*time.Minute))
+	if len(newFailures) != 0 || len(recovered) != 1 || recovered[0].CampgroundID != "camp1" || !recovered[0].Since.Equal(now) {
+		t.Fatalf("Expected camp1 to recover, got %+v %+v", newFailures, recovered)
+	}
+
+	if FormatFailureReport(nil, nil) != "" {
+		t.Errorf("Expected empty report when nothing changed")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -10,13 +11,22 @@ import (
 	"go.uber.org/zap"
 )
 
-func HandleNewSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection) {
+func HandleNewSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, providers ProviderRegistry) {
 	data := i.ApplicationCommandData()
 
 	var campground SummarisedCampground
 	var startDate, endDate time.Time
 	var campsiteList []string
 	minConsecutiveDays := int64(1)
+	var checkInDays []time.Weekday
+	var checkInNights int64
+	var stayLength int64
+	var partySize int64
+	var includeTypes, excludeTypes []string
+	var typeOfUse, email string
+	var loops []string
+	var vehicleLength int64
+	var accessibleOnly, withPets bool
 	var err error
 	for _, option := range data.Options {
 		switch option.Name {
@@ -54,12 +64,82 @@ func HandleNewSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.Intera
 				return
 			}
 		case "campsite-list":
-			campsiteList = strings.Split(option.StringValue(), ",")
+			campsiteList = ParseCampsiteList(option.StringValue())
 		case "minimum-consecutive-days":
 			minConsecutiveDays = option.IntValue()
+		case "stay-length":
+			stayLength = option.IntValue()
+		case "party-size":
+			partySize = option.IntValue()
+		case "include-types":
+			includeTypes = ParseCommaList(option.StringValue())
+		case "exclude-types":
+			excludeTypes = ParseCommaList(option.StringValue())
+		case "use-type":
+			typeOfUse = strings.TrimSpace(option.StringValue())
+		case "loops":
+			loops = ParseCommaList(option.StringValue())
+		case "vehicle-length":
+			vehicleLength = option.IntValue()
+		case "accessible":
+			accessibleOnly = option.BoolValue()
+		case "pets":
+			withPets = option.BoolValue()
+		case "email":
+			email, err = ParseEmail(option.StringValue())
+			if err != nil {
+				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Content: fmt.Sprintf("Invalid email: %v", err),
+					},
+				})
+				return
+			}
+		case "check-in-days":
+			checkInDays, checkInNights, err = ParseCheckInDays(option.StringValue())
+			if err != nil {
+				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Content: fmt.Sprintf("Invalid check-in days: %v", err),
+					},
+				})
+				return
+			}
 		}
 	}
 
+	if partySize < 0 {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Party size can't be negative",
+			},
+		})
+		return
+	}
+
+	if vehicleLength < 0 {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Vehicle length can't be negative",
+			},
+		})
+		return
+	}
+
+	if stayLength < 0 || stayLength > int64(endDate.Sub(startDate).Hours()/24)+1 {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Stay length must fit between the start and end dates",
+			},
+		})
+		return
+	}
+
 	if startDate.After(endDate) {
 		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -70,8 +150,21 @@ func HandleNewSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.Intera
 		return
 	}
 
-	_ = campsiteList
-	_ = minConsecutiveDays
+	provider, err := providers.Get(campground.Source)
+	if err != nil {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Can't schniff %s: %v", campground.Name, err),
+			},
+		})
+		return
+	}
+
+	deferred, ok := verifyCampsites(log, s, i, provider, campground.ID, campground.Name, campsiteList)
+	if !ok {
+		return
+	}
 
 	var user *discordgo.User
 	if i.Member == nil {
@@ -81,7 +174,8 @@ func HandleNewSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.Intera
 	}
 
 	schniff := &Schniff{
-		CampgroundID:           data.Options[0].StringValue(),
+		Provider:               provider.Name(),
+		CampgroundID:           campground.ID,
 		CampgroundName:         campground.Name,
 		StartDate:              startDate,
 		EndDate:                endDate,
@@ -92,11 +186,43 @@ func HandleNewSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.Intera
 		CreationTime:           time.Now(),
 		CampsiteIDs:            campsiteList,
 		MinimumConsecutiveDays: minConsecutiveDays,
+		CheckInDays:            checkInDays,
+		CheckInNights:          checkInNights,
+		StayLength:             stayLength,
+		PartySize:              partySize,
+		IncludeTypes:           includeTypes,
+		ExcludeTypes:           excludeTypes,
+		TypeOfUse:              typeOfUse,
+		Loops:                  loops,
+		VehicleLength:          vehicleLength,
+		AccessibleOnly:         accessibleOnly,
+		WithPets:               withPets,
+		Email:                  email,
 	}
 
 	err = sc.Add(schniff)
 	if err != nil {
 		log.Error("Cannot add schniff", zap.Error(err))
+		content := fmt.Sprintf("Unable to save your schniff, please try again: %v", err)
+		if deferred {
+			_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &content,
+			})
+			if err != nil {
+				log.Error("Cannot edit interaction response", zap.Error(err))
+			}
+			return
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+			},
+		})
+		if err != nil {
+			log.Error("Cannot respond to interaction", zap.Error(err))
+		}
+		return
 	}
 
 	duration := endDate.Sub(startDate).Hours() / 24 // calculates duration in days
@@ -153,6 +279,89 @@ func HandleNewSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.Intera
 		Color: 0x009900, // Green color
 	}
 
+	if schniff.StayLength > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Stay Length",
+			Value:  stayLengthString(schniff.StayLength),
+			Inline: false,
+		})
+	}
+
+	if schniff.PartySize > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Party Size",
+			Value:  partySizeString(schniff.PartySize),
+			Inline: true,
+		})
+	}
+
+	if len(schniff.IncludeTypes) > 0 || len(schniff.ExcludeTypes) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Campsite Types",
+			Value:  fmt.Sprintf("Include: %s\nExclude: %s", listString(schniff.IncludeTypes, "All"), listString(schniff.ExcludeTypes, "None")),
+			Inline: false,
+		})
+	}
+
+	if schniff.TypeOfUse != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Use Type",
+			Value:  schniff.TypeOfUse,
+			Inline: true,
+		})
+	}
+
+	if len(schniff.Loops) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Loops",
+			Value:  listString(schniff.Loops, "All"),
+			Inline: true,
+		})
+	}
+
+	if details := detailFiltersString(schniff); details != "Any" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Campsite Details",
+			Value:  details,
+			Inline: false,
+		})
+	}
+
+	if schniff.Email != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Email",
+			Value:  MaskEmail(schniff.Email),
+			Inline: true,
+		})
+	}
+
+	if len(schniff.CheckInDays) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Check-in Days",
+			Value:  fmt.Sprintf("%s (at least %d nights)", checkInDaysString(schniff.CheckInDays), schniff.MinimumNights()),
+			Inline: false,
+		})
+	}
+
+	if len(schniff.CampsiteIDs) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Campsite IDs",
+			Value:  strings.Join(schniff.CampsiteIDs, ", "),
+			Inline: false,
+		})
+	}
+
+	if deferred {
+		embeds := []*discordgo.MessageEmbed{embed}
+		_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Embeds: &embeds,
+		})
+		if err != nil {
+			log.Error("Cannot edit interaction response", zap.Error(err))
+		}
+		return
+	}
+
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
@@ -164,15 +373,32 @@ func HandleNewSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.Intera
 	}
 }
 
-func HandleNewSchniffAutocomplete(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection) {
+func HandleNewSchniffAutocomplete(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, cc *CampgroundCollection, ci *CampsiteIndex) {
 	data := i.ApplicationCommandData()
 	var choices []*discordgo.ApplicationCommandOptionChoice
-	switch {
+
+	var campgroundID string
+	for _, option := range data.Options {
+		if option.Name == "campground" {
+			campgroundID = option.StringValue()
+		}
+	}
+
 	// In this case there are multiple autocomplete options. The Focused field shows which option user is focused on.
-	case data.Options[0].Focused:
-		allChoices := cc.GetCampgrounds()
-		userInput := data.Options[0].StringValue()
-		choices = suggestBestMatchesForCampground(allChoices, userInput)
+	for _, option := range data.Options {
+		if !option.Focused {
+			continue
+		}
+		if option.Name == "campground" {
+			choices = suggestBestMatchesForCampground(cc.GetCampgrounds(), option.StringValue())
+			continue
+		}
+		// everything else is about the campsites at the campground picked already
+		campground, err := cc.GetCampground(campgroundID)
+		if err != nil {
+			continue
+		}
+		choices = suggestCampsiteOption(log, ci, campground.Source, campground.ID, option)
 	}
 
 	if len(choices) > 10 {
@@ -190,7 +416,16 @@ func HandleNewSchniffAutocomplete(log *zap.Logger, s *discordgo.Session, i *disc
 	}
 }
 
-func HandleViewSchniffs(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection) {
+func HandleViewSchniffs(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, providers ProviderRegistry) {
+	data := i.ApplicationCommandData()
+
+	archived := false
+	for _, option := range data.Options {
+		if option.Name == "archived" {
+			archived = option.BoolValue()
+		}
+	}
+
 	// get all this user's schniffs
 	var user *discordgo.User
 	if i.Member == nil {
@@ -198,8 +433,22 @@ func HandleViewSchniffs(log *zap.Logger, s *discordgo.Session, i *discordgo.Inte
 	} else {
 		user = i.Member.User
 	}
-	schniffs := sc.GetSchniffsForUser(user.ID)
-	table := GenerateEmbedMessage(schniffs)
+
+	var table *discordgo.MessageEmbed
+	if archived {
+		schniffs, err := sc.GetArchivedSchniffsForUser(user.ID)
+		if err != nil {
+			log.Error("Cannot load archived schniffs", zap.Error(err))
+		}
+		// discord only allows so many fields in an embed
+		if len(schniffs) > maxEmbedFields {
+			schniffs = schniffs[:maxEmbedFields]
+		}
+		table = GenerateEmbedMessage(providers, schniffs)
+		table.Title = "Archived Schniffs"
+	} else {
+		table = GenerateEmbedMessage(providers, sc.GetSchniffsForUser(user.ID))
+	}
 
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -212,6 +461,405 @@ func HandleViewSchniffs(log *zap.Logger, s *discordgo.Session, i *discordgo.Inte
 	}
 }
 
+// campsiteOptions are the options autocompleted from what the campsites at a campground are like. List
+// options take a comma separated list of values.
+var campsiteOptions = map[string]struct {
+	field func(Campsite) string
+	list  bool
+}{
+	"include-types": {field: func(c Campsite) string { return c.CampsiteType }, list: true},
+	"exclude-types": {field: func(c Campsite) string { return c.CampsiteType }, list: true},
+	"use-type":      {field: func(c Campsite) string { return c.TypeOfUse }, list: false},
+	"loops":         {field: func(c Campsite) string { return c.Loop }, list: true},
+}
+
+// suggestCampsiteOption offers the values of the focused option seen at the campground
+func suggestCampsiteOption(log *zap.Logger, ci *CampsiteIndex, provider, campgroundID string, option *discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandOptionChoice {
+	campsiteOption, ok := campsiteOptions[option.Name]
+	if !ok {
+		return nil
+	}
+
+	// discord only waits three seconds for suggestions, and we might have to ask the provider
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	values, err := ci.Values(ctx, log, provider, campgroundID, campsiteOption.field)
+	if err != nil {
+		log.Warn("Cannot get campsites to suggest from", zap.String("campground_id", campgroundID), zap.Error(err))
+		return nil
+	}
+
+	return suggestValues(values, option.StringValue(), campsiteOption.list)
+}
+
+// verifyCampsites checks every campsite in the list exists at the campground, telling the user about any that
+// don't. Checking means a round trip to the provider, which can take longer than discord is willing to wait
+// for a response, so the response is deferred and needs to be edited rather than sent once we know.
+func verifyCampsites(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, provider Provider, campgroundID, campgroundName string, campsiteList []string) (deferred bool, ok bool) {
+	if len(campsiteList) == 0 {
+		return false, true
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Error("Cannot respond to interaction", zap.Error(err))
+		return false, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	campsites, err := provider.GetCampsites(ctx, log, campgroundID)
+	if err != nil {
+		log.Error("Cannot get availability to check campsites", zap.Error(err))
+		content := fmt.Sprintf("Unable to check campsites for %s, please try again: %v", campgroundName, err)
+		_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+		if err != nil {
+			log.Error("Cannot edit interaction response", zap.Error(err))
+		}
+		return true, false
+	}
+
+	unknownCampsites := FindUnknownCampsites(campsites, campsiteList)
+	if len(unknownCampsites) > 0 {
+		content := fmt.Sprintf("These campsite IDs don't exist at %s: %s", campgroundName, strings.Join(unknownCampsites, ", "))
+		_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+		if err != nil {
+			log.Error("Cannot edit interaction response", zap.Error(err))
+		}
+		return true, false
+	}
+
+	return true, true
+}
+
+func HandleEditSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, providers ProviderRegistry) {
+	data := i.ApplicationCommandData()
+
+	var user *discordgo.User
+	if i.Member == nil {
+		user = i.User
+	} else {
+		user = i.Member.User
+	}
+
+	respond := func(content string) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+			},
+		})
+		if err != nil {
+			log.Error("Cannot respond to interaction", zap.Error(err))
+		}
+	}
+
+	var schniff *Schniff
+	for _, option := range data.Options {
+		if option.Name != "schniff-id" {
+			continue
+		}
+		var err error
+		schniff, err = sc.GetSchniff(option.StringValue())
+		if err != nil || schniff.UserID != user.ID {
+			respond(fmt.Sprintf("Schniff not found: %v", option.StringValue()))
+			return
+		}
+	}
+	if schniff == nil {
+		respond("Pick the schniff to edit")
+		return
+	}
+
+	// start from a copy so nothing changes until the edit is stored
+	before := *schniff
+	updated := *schniff
+	campsiteListChanged := false
+	for _, option := range data.Options {
+		var err error
+		switch option.Name {
+		case "start":
+			updated.StartDate, err = time.Parse("2006-01-02", option.StringValue())
+			if err != nil {
+				respond(fmt.Sprintf("Invalid start date: %v", err))
+				return
+			}
+		case "end":
+			updated.EndDate, err = time.Parse("2006-01-02", option.StringValue())
+			if err != nil {
+				respond(fmt.Sprintf("Invalid end date: %v", err))
+				return
+			}
+		case "campsite-list":
+			// all goes back to watching every campsite
+			updated.CampsiteIDs = nil
+			if !strings.EqualFold(strings.TrimSpace(option.StringValue()), "all") {
+				updated.CampsiteIDs = ParseCampsiteList(option.StringValue())
+			}
+			campsiteListChanged = true
+		case "minimum-consecutive-days":
+			updated.MinimumConsecutiveDays = option.IntValue()
+		case "stay-length":
+			updated.StayLength = option.IntValue()
+		case "party-size":
+			updated.PartySize = option.IntValue()
+		case "include-types":
+			// all goes back to every type
+			updated.IncludeTypes = nil
+			if !strings.EqualFold(strings.TrimSpace(option.StringValue()), "all") {
+				updated.IncludeTypes = ParseCommaList(option.StringValue())
+			}
+		case "exclude-types":
+			updated.ExcludeTypes = nil
+			if !strings.EqualFold(strings.TrimSpace(option.StringValue()), "none") {
+				updated.ExcludeTypes = ParseCommaList(option.StringValue())
+			}
+		case "use-type":
+			updated.TypeOfUse = strings.TrimSpace(option.StringValue())
+			if strings.EqualFold(updated.TypeOfUse, "any") {
+				updated.TypeOfUse = ""
+			}
+		case "vehicle-length":
+			// zero goes back to any campsite
+			updated.VehicleLength = option.IntValue()
+		case "accessible":
+			updated.AccessibleOnly = option.BoolValue()
+		case "pets":
+			updated.WithPets = option.BoolValue()
+		case "email":
+			// off stops the emails
+			updated.Email = ""
+			if strings.EqualFold(strings.TrimSpace(option.StringValue()), "off") {
+				continue
+			}
+			updated.Email, err = ParseEmail(option.StringValue())
+			if err != nil {
+				respond(fmt.Sprintf("Invalid email: %v", err))
+				return
+			}
+		case "loops":
+			// all goes back to every loop
+			updated.Loops = nil
+			if !strings.EqualFold(strings.TrimSpace(option.StringValue()), "all") {
+				updated.Loops = ParseCommaList(option.StringValue())
+			}
+		case "check-in-days":
+			// any goes back to allowing every day, and to the minimum stay from before the preset
+			updated.CheckInDays = nil
+			updated.CheckInNights = 0
+			if strings.EqualFold(strings.TrimSpace(option.StringValue()), "any") {
+				continue
+			}
+			updated.CheckInDays, updated.CheckInNights, err = ParseCheckInDays(option.StringValue())
+			if err != nil {
+				respond(fmt.Sprintf("Invalid check-in days: %v", err))
+				return
+			}
+		}
+	}
+
+	if updated.StartDate.After(updated.EndDate) {
+		respond("Start date must be before end date")
+		return
+	}
+	if updated.PartySize < 0 {
+		respond("Party size can't be negative")
+		return
+	}
+
+	if updated.VehicleLength < 0 {
+		respond("Vehicle length can't be negative")
+		return
+	}
+	if updated.StayLength < 0 || updated.StayLength > int64(updated.EndDate.Sub(updated.StartDate).Hours()/24)+1 {
+		respond("Stay length must fit between the start and end dates")
+		return
+	}
+
+	provider, err := providers.Get(updated.Provider)
+	if err != nil {
+		respond(fmt.Sprintf("Can't schniff %s: %v", updated.CampgroundName, err))
+		return
+	}
+
+	deferred := false
+	if campsiteListChanged {
+		var ok bool
+		deferred, ok = verifyCampsites(log, s, i, provider, updated.CampgroundID, updated.CampgroundName, updated.CampsiteIDs)
+		if !ok {
+			return
+		}
+	}
+
+	updated.UpdatedTime = time.Now()
+	err = sc.Update(&updated)
+	if err != nil {
+		log.Error("Cannot update schniff", zap.Error(err))
+		content := fmt.Sprintf("Unable to save your changes, please try again: %v", err)
+		if deferred {
+			_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &content,
+			})
+			if err != nil {
+				log.Error("Cannot edit interaction response", zap.Error(err))
+			}
+			return
+		}
+		respond(content)
+		return
+	}
+
+	embed := GenerateEditEmbed(&before, &updated)
+	if deferred {
+		embeds := []*discordgo.MessageEmbed{embed}
+		_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Embeds: &embeds,
+		})
+		if err != nil {
+			log.Error("Cannot edit interaction response", zap.Error(err))
+		}
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+		},
+	})
+	if err != nil {
+		log.Error("Cannot respond to interaction", zap.Error(err))
+	}
+}
+
+func HandleEditSchniffAutocomplete(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection, ci *CampsiteIndex) {
+	data := i.ApplicationCommandData()
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	var user *discordgo.User
+	if i.Member == nil {
+		user = i.User
+	} else {
+		user = i.Member.User
+	}
+
+	var schniffID string
+	for _, option := range data.Options {
+		if option.Name == "schniff-id" {
+			schniffID = option.StringValue()
+		}
+	}
+
+	for _, option := range data.Options {
+		if !option.Focused {
+			continue
+		}
+		if option.Name == "schniff-id" {
+			choices = suggestBestMatchesForSchniff(sc.GetSchniffsForUser(user.ID), option.StringValue())
+			continue
+		}
+		// everything else is about the campsites at the schniff's campground
+		schniff, err := sc.GetSchniff(schniffID)
+		if err != nil || schniff.UserID != user.ID {
+			continue
+		}
+		choices = suggestCampsiteOption(log, ci, schniff.ProviderName(), schniff.CampgroundID, option)
+	}
+
+	if len(choices) > 10 {
+		choices = choices[:10]
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Error("Cannot respond to interaction", zap.Error(err))
+	}
+}
+
+func HandleDeleteSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection) {
+	data := i.ApplicationCommandData()
+
+	schniffID := data.Options[0].StringValue()
+
+	var user *discordgo.User
+	if i.Member == nil {
+		user = i.User
+	} else {
+		user = i.Member.User
+	}
+
+	content := "Deleted your schniff."
+	schniff, err := sc.GetSchniff(schniffID)
+	if err != nil {
+		// schniffs that are over can be deleted from the archive too
+		schniff, err = sc.GetArchivedSchniff(schniffID)
+	}
+	if err != nil || schniff.UserID != user.ID {
+		content = fmt.Sprintf("Schniff not found: %s", schniffID)
+	} else {
+		err = sc.Delete(schniffID)
+		if err != nil {
+			log.Error("Cannot delete schniff", zap.Error(err))
+			content = fmt.Sprintf("Unable to delete your schniff, please try again: %v", err)
+		}
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+		},
+	})
+	if err != nil {
+		log.Error("Cannot respond to interaction", zap.Error(err))
+	}
+}
+
+func HandleDeleteSchniffAutocomplete(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection) {
+	data := i.ApplicationCommandData()
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	var user *discordgo.User
+	if i.Member == nil {
+		user = i.User
+	} else {
+		user = i.Member.User
+	}
+	switch {
+	case data.Options[0].Focused:
+		userInput := data.Options[0].StringValue()
+		schniffs := sc.GetSchniffsForUser(user.ID)
+		archived, err := sc.GetArchivedSchniffsForUser(user.ID)
+		if err != nil {
+			log.Error("Cannot get archived schniffs", zap.Error(err))
+		}
+		choices = suggestBestMatchesForSchniff(append(schniffs, archived...), userInput)
+	}
+
+	if len(choices) > 10 {
+		choices = choices[:10]
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Error("Cannot respond to interaction", zap.Error(err))
+	}
+}
+
 func HandleRestartSchniff(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, sc *SchniffCollection) {
 	data := i.ApplicationCommandData()
 
@@ -400,3 +1048,158 @@ func HandleGuildMemberAdd(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
 
 	sendMessageToChannelInAllGuilds(s, "announcements", RandomSillyGreeting(m.Member.User.ID))
 }
+
+func HandleHeatmap(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, cc *CampgroundCollection, ss *SnapshotStore) {
+	data := i.ApplicationCommandData()
+
+	var campground SummarisedCampground
+	var err error
+	for _, option := range data.Options {
+		switch option.Name {
+		case "campground":
+			campground, err = cc.GetCampground(option.StringValue())
+			if err != nil {
+				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Content: fmt.Sprintf("Campground not found: %v", option.StringValue()),
+					},
+				})
+				return
+			}
+		}
+	}
+
+	transitions, err := ss.Transitions(campground.Source, campground.ID)
+	if err != nil {
+		log.Error("Unable to get transitions", zap.Error(err))
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Couldn't get the history for %s: %v", campground.Name, err),
+			},
+		})
+		return
+	}
+
+	location, err := time.LoadLocation(HeatmapLocation)
+	if err != nil {
+		log.Error("Unable to load heatmap location", zap.Error(err))
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Couldn't load the %s timezone for the heatmap: %v", HeatmapLocation, err),
+			},
+		})
+		return
+	}
+	heatmap := BuildHeatmap(transitions, location)
+	if heatmap.Cancellations == 0 {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("I haven't seen any cancellations at %s yet. I only keep history for campgrounds someone is schniffing.", campground.Name),
+			},
+		})
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{GenerateHeatmapEmbed(campground, heatmap, location)},
+		},
+	})
+	if err != nil {
+		log.Error("Cannot respond to interaction", zap.Error(err))
+	}
+}
+
+func HandleHeatmapAutocomplete(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, cc *CampgroundCollection) {
+	data := i.ApplicationCommandData()
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	switch {
+	case data.Options[0].Focused:
+		choices = suggestBestMatchesForCampground(cc.GetCampgrounds(), data.Options[0].StringValue())
+	}
+
+	if len(choices) > 10 {
+		choices = choices[:10]
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Error("Cannot respond to interaction", zap.Error(err))
+	}
+}
+
+// HandlePreferences shows the user's preferences, changing whatever options they gave first
+func HandlePreferences(log *zap.Logger, s *discordgo.Session, i *discordgo.InteractionCreate, ps *PreferenceStore) {
+	data := i.ApplicationCommandData()
+
+	var user *discordgo.User
+	if i.Member == nil {
+		user = i.User
+	} else {
+		user = i.Member.User
+	}
+
+	respond := func(content string) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+			},
+		})
+		if err != nil {
+			log.Error("Cannot respond to interaction", zap.Error(err))
+		}
+	}
+
+	preferences := ps.Get(user.ID)
+	if len(data.Options) == 0 {
+		respond(fmt.Sprintf("Your preferences:\n%s", PreferencesString(preferences)))
+		return
+	}
+
+	for _, option := range data.Options {
+		switch option.Name {
+		case "timezone":
+			preferences.Timezone = strings.TrimSpace(option.StringValue())
+		case "quiet-start", "quiet-end":
+			// off for either turns quiet hours off altogether
+			clock := strings.TrimSpace(option.StringValue())
+			if strings.EqualFold(clock, "off") {
+				preferences.QuietStart = ""
+				preferences.QuietEnd = ""
+				continue
+			}
+			if option.Name == "quiet-start" {
+				preferences.QuietStart = clock
+			} else {
+				preferences.QuietEnd = clock
+			}
+		case "delivery":
+			preferences.Delivery = option.StringValue()
+		case "mention-in-announcements":
+			preferences.HideFromBroadcast = !option.BoolValue()
+		}
+	}
+
+	err := ps.Set(preferences)
+	if err != nil {
+		respond(fmt.Sprintf("Couldn't save your preferences: %v", err))
+		return
+	}
+
+	message := fmt.Sprintf("Saved your preferences:\n%s", PreferencesString(preferences))
+	if (preferences.QuietStart == "") != (preferences.QuietEnd == "") {
+		message += "\nQuiet hours need both a start and an end before they do anything."
+	}
+	respond(message)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// HeatmapLocation is the timezone heatmaps are shown in
+const HeatmapLocation = "America/Los_Angeles"
+
+// Heatmap summarises when cancellations show up at a campground
+type Heatmap struct {
+	Cancellations int
+	// Weekdays, Months and Hours count cancellations by when we saw them
+	Weekdays [7]int
+	Months   [12]int
+	Hours    [24]int
+	// Rebooked is how many cancellations we saw get booked again, and MedianOpen is how long they were open
+	// for in the middle
+	Rebooked   int
+	MedianOpen time.Duration
+	// Since is the first transition we have for the campground
+	Since time.Time
+}
+
+// BuildHeatmap counts the cancellations in the transitions, which should be oldest first. A cancellation is a
+// campsite night going from reserved to available. Times are counted in location.
+func BuildHeatmap(transitions []Transition, location *time.Location) Heatmap {
+	var heatmap Heatmap
+	if len(transitions) > 0 {
+		heatmap.Since = transitions[0].At
+	}
+
+	opened := make(map[string]time.Time)
+	var openDurations []time.Duration
+	for _, transition := range transitions {
+		key := transition.CampsiteID + "/" + transition.Date.Format("2006-01-02")
+
+		if transition.From == StateReserved && transition.To == StateAvailable {
+			at := transition.At.In(location)
+			heatmap.Cancellations++
+			heatmap.Weekdays[at.Weekday()]++
+			heatmap.Months[at.Month()-1]++
+			heatmap.Hours[at.Hour()]++
+			opened[key] = transition.At
+			continue
+		}
+
+		if transition.From != StateAvailable {
+			continue
+		}
+		openedAt, ok := opened[key]
+		if !ok {
+			continue
+		}
+		delete(opened, key)
+		openDurations = append(openDurations, transition.At.Sub(openedAt))
+	}
+
+	heatmap.Rebooked = len(openDurations)
+	if len(openDurations) > 0 {
+		sort.Slice(openDurations, func(i, j int) bool {
+			return openDurations[i] < openDurations[j]
+		})
+		middle := len(openDurations) / 2
+		heatmap.MedianOpen = openDurations[middle]
+		if len(openDurations)%2 == 0 {
+			heatmap.MedianOpen = (openDurations[middle-1] + openDurations[middle]) / 2
+		}
+	}
+
+	return heatmap
+}
+
+// barChart draws a bar for each label, scaled so the biggest count fills width
+func barChart(labels []string, counts []int, width int) string {
+	biggest := 0
+	for _, count := range counts {
+		if count > biggest {
+			biggest = count
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString("```\n")
+	for i, label := range labels {
+		bar := 0
+		if biggest > 0 {
+			bar = (counts[i]*width + biggest - 1) / biggest
+		}
+		builder.WriteString(fmt.Sprintf("%s %-*s %d\n", label, width, strings.Repeat("█", bar), counts[i]))
+	}
+	builder.WriteString("```")
+	return builder.String()
+}
+
+// GenerateHeatmapEmbed shows the heatmap for the campground
+func GenerateHeatmapEmbed(campground SummarisedCampground, heatmap Heatmap, location *time.Location) *discordgo.MessageEmbed {
+	weekdays := []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+	months := make([]string, 12)
+	for i := range months {
+		months[i] = time.Month(i + 1).String()[:3]
+	}
+
+	hours := make([]string, 24)
+	for hour := range hours {
+		hours[hour] = fmt.Sprintf("%02d", hour)
+	}
+
+	medianOpen := "Haven't seen one get booked again yet"
+	if heatmap.Rebooked > 0 {
+		medianOpen = fmt.Sprintf("%s (from %d rebooked)", formatOpenDuration(heatmap.MedianOpen), heatmap.Rebooked)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Cancellations at %s", campground.Name),
+		Description: fmt.Sprintf("%d cancellations seen since %s. Times are %s.", heatmap.Cancellations, heatmap.Since.In(location).Format("2006-01-02"), location.String()),
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  "Day of the week",
+				Value: barChart(weekdays, heatmap.Weekdays[:], 12),
+			},
+			{
+				Name:  "Month",
+				Value: barChart(months, heatmap.Months[:], 12),
+			},
+			{
+				Name:  "Hour of day",
+				Value: barChart(hours, heatmap.Hours[:], 12),
+			},
+			{
+				Name:  "Median time open before it's booked again",
+				Value: medianOpen,
+			},
+		},
+	}
+}
+
+func formatOpenDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%.1f hours", d.Hours())
+	}
+	return fmt.Sprintf("%.1f days", d.Hours()/24)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildHeatmap(t *testing.T) {
+	location, err := time.LoadLocation(HeatmapLocation)
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+
+	night := time.Date(2023, 8, 12, 0, 0, 0, 0, time.UTC)
+	// saturday the 1st of july, 7am pacific
+	saturdayMorning := time.Date(2023, 7, 1, 7, 0, 0, 0, location)
+	transitions := []Transition{
+		// freed and rebooked 10 minutes later
+		{CampsiteID: "site1", Date: night, From: StateReserved, To: StateAvailable, At: saturdayMorning},
+		{CampsiteID: "site1", Date: night, From: StateAvailable, To: StateReserved, At: saturdayMorning.Add(10 * time.Minute)},
+		// freed again and rebooked 30 minutes later
+		{CampsiteID: "site1", Date: night, From: StateReserved, To: StateAvailable, At: saturdayMorning.Add(time.Hour)},
+		{CampsiteID: "site1", Date: night, From: StateAvailable, To: StateReserved, At: saturdayMorning.Add(90 * time.Minute)},
+		// freed on a tuesday evening in august and still open
+		{CampsiteID: "site2", Date: night, From: StateReserved, To: StateAvailable, At: time.Date(2023, 8, 1, 19, 0, 0, 0, location)},
+		// releases and closures aren't cancellations
+		{CampsiteID: "site3", Date: night, From: StateNotYetReleased, To: StateAvailable, At: saturdayMorning},
+		{CampsiteID: "site3", Date: night, From: StateAvailable, To: StateReserved, At: saturdayMorning.Add(time.Minute)},
+		{CampsiteID: "site4", Date: night, From: StateReserved, To: StateClosed, At: saturdayMorning},
+	}
+
+	heatmap := BuildHeatmap(transitions, location)
+
+	if heatmap.Cancellations != 3 {
+		t.Errorf("Expected 3 cancellations, got %d", heatmap.Cancellations)
+	}
+	if heatmap.Weekdays[time.Saturday] != 2 || heatmap.Weekdays[time.Tuesday] != 1 {
+		t.Errorf("Unexpected weekdays: %v", heatmap.Weekdays)
+	}
+	if heatmap.Months[time.July-1] != 2 || heatmap.Months[time.August-1] != 1 {
+		t.Errorf("Unexpected months: %v", heatmap.Months)
+	}
+	if heatmap.Hours[7] != 1 || heatmap.Hours[8] != 1 || heatmap.Hours[19] != 1 {
+		t.Errorf("Unexpected hours: %v", heatmap.Hours)
+	}
+	if heatmap.Rebooked != 2 {
+		t.Errorf("Expected 2 rebooked, got %d", heatmap.Rebooked)
+	}
+	if heatmap.MedianOpen != 20*time.Minute {
+		t.Errorf("Expected median open of 20 minutes, got %s", heatmap.MedianOpen)
+	}
+
+	embed := GenerateHeatmapEmbed(SummarisedCampground{Name: "North Pines"}, heatmap, location)
+	if !strings.Contains(embed.Fields[0].Value, "Sat ████████████ 2") {
+		t.Errorf("Expected saturday to have the longest bar, got:\n%s", embed.Fields[0].Value)
+	}
+	// every hour gets its own bar
+	if !strings.Contains(embed.Fields[2].Value, "07 ████████████ 1") || !strings.Contains(embed.Fields[2].Value, "08 ████████████ 1") || strings.Count(embed.Fields[2].Value, "\n") != 25 {
+		t.Errorf("Expected a bar for each hour, got:\n%s", embed.Fields[2].Value)
+	}
+	if !strings.Contains(embed.Fields[3].Value, "20 minutes") {
+		t.Errorf("Expected the median open time in the embed, got %s", embed.Fields[3].Value)
+	}
+}
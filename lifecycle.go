@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// LifecycleConfig controls the job that keeps schniffs in step with the calendar
+type LifecycleConfig struct {
+	// Interval is how often the job runs
+	Interval time.Duration
+	// Timezone is where the day has to be over before its night is dropped from schniffs
+	Timezone string
+}
+
+// Today is the date it is in location, as midnight UTC to match schniff dates
+func Today(now time.Time, location *time.Location) time.Time {
+	local := now.In(location)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// GenerateExpiryMessage writes the DM telling someone their schniff ran out of dates without finding anything
+func GenerateExpiryMessage(schniff *Schniff) string {
+	return fmt.Sprintf(
+		"Your schniff at %s is over, the last night you wanted was %s and nothing came up. Sorry about that. It's been archived, use /new-schniff to look for another trip.",
+		schniff.CampgroundName,
+		schniff.EndDate.Format("Mon Jan 2"),
+	)
+}
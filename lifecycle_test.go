@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestToday(t *testing.T) {
+	losAngeles, _ := time.LoadLocation("America/Los_Angeles")
+
+	// 5am UTC is still the night before in california
+	got := Today(time.Date(2023, 10, 2, 5, 0, 0, 0, time.UTC), losAngeles)
+	expected := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	if !got.Equal(expected) {
+		t.Errorf("Expected today to be %s, got %s", expected, got)
+	}
+}
+
+func TestSchniffCollectionRoll(t *testing.T) {
+	store := NewJSONSchniffStore(filepath.Join(t.TempDir(), "schniffs.json"))
+	sc, err := NewSchniffCollection(store, nil)
+	if err != nil {
+		t.Fatalf("Failed to create schniff collection: %v", err)
+	}
+
+	date := func(month, day int) time.Time {
+		return time.Date(2023, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	}
+	schniffs := []*Schniff{
+		{SchniffID: "rolling", Active: true, StartDate: date(9, 20), EndDate: date(10, 5)},
+		{SchniffID: "future", Active: true, StartDate: date(11, 1), EndDate: date(11, 5)},
+		{SchniffID: "missed", Active: true, StartDate: date(9, 20), EndDate: date(9, 30)},
+		{SchniffID: "hit", Active: true, StartDate: date(9, 20), EndDate: date(9, 30), LastNotified: date(9, 1)},
+		{SchniffID: "stopped", Active: false, StartDate: date(9, 20), EndDate: date(9, 30)},
+	}
+	for _, schniff := range schniffs {
+		err = sc.Add(schniff)
+		if err != nil {
+			t.Fatalf("Failed to add schniff: %v", err)
+		}
+	}
+
+	expired, err := sc.Roll(date(10, 1))
+	if err != nil {
+		t.Fatalf("Failed to roll schniffs: %v", err)
+	}
+
+	// only the ones that were still running when they expired are returned
+	var expiredIDs []string
+	for _, schniff := range expired {
+		expiredIDs = append(expiredIDs, schniff.SchniffID)
+	}
+	if diff := cmp.Diff([]string{"missed", "hit"}, expiredIDs); diff != "" {
+		t.Errorf("Expired schniffs mismatch (-want +got):\n%s", diff)
+	}
+
+	sc, err = NewSchniffCollection(store, nil)
+	if err != nil {
+		t.Fatalf("Failed to load schniffs: %v", err)
+	}
+	type state struct {
+		Active, Expired bool
+		StartDate       time.Time
+	}
+	got := make(map[string]state)
+	for _, schniff := range sc.schniffs {
+		got[schniff.SchniffID] = state{schniff.Active, schniff.Expired, schniff.StartDate}
+	}
+	expected := map[string]state{
+		"rolling": {Active: true, StartDate: date(10, 1)},
+		"future":  {Active: true, StartDate: date(11, 1)},
+		"missed":  {Expired: true, StartDate: date(9, 20)},
+		"hit":     {Expired: true, StartDate: date(9, 20)},
+		"stopped": {Expired: true, StartDate: date(9, 20)},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Stored schniffs mismatch (-want +got):\n%s", diff)
+	}
+
+	// rolling again on the same day has nothing to do
+	expired, err = sc.Roll(date(10, 1))
+	if err != nil {
+		t.Fatalf("Failed to roll schniffs: %v", err)
+	}
+	if len(expired) != 0 {
+		t.Errorf("Expected nothing to expire twice, got %d", len(expired))
+	}
+}
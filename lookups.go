@@ -154,3 +154,41 @@ type ScoredSchniff struct {
 	schniff *Schniff
 	score   int
 }
+
+// suggestValues offers the values that match what the user is typing. With list set the input is a comma
+// separated list and only its last entry is completed, keeping what was already picked in front of it.
+func suggestValues(values []string, userInput string, list bool) []*discordgo.ApplicationCommandOptionChoice {
+	partial := userInput
+	var picked []string
+	if list {
+		picked = ParseCommaList(userInput)
+		if !strings.HasSuffix(strings.TrimSpace(userInput), ",") && len(picked) > 0 {
+			partial = picked[len(picked)-1]
+			picked = picked[:len(picked)-1]
+		} else {
+			partial = ""
+		}
+	}
+	lowerPartial := strings.ToLower(strings.TrimSpace(partial))
+
+	var matches []*discordgo.ApplicationCommandOptionChoice
+	for _, value := range values {
+		if containsFold(picked, value) || !strings.Contains(strings.ToLower(value), lowerPartial) {
+			continue
+		}
+		choice := strings.Join(append(append([]string{}, picked...), value), ", ")
+		// discord won't take a choice over 100 characters
+		if len(choice) > 100 {
+			continue
+		}
+		matches = append(matches, &discordgo.ApplicationCommandOptionChoice{
+			Name:  choice,
+			Value: choice,
+		})
+		if len(matches) == 10 {
+			break
+		}
+	}
+
+	return matches
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	pc "github.com/brensch/proxy/client"
@@ -16,30 +18,71 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	log := zap.NewExample()
 
+	config, err := LoadConfig()
+	if err != nil {
+		log.Fatal("couldn't load config", zap.Error(err))
+	}
+
 	p, err := pc.InitClient("proxy-362608")
 	if err != nil {
 		log.Fatal("couldn't start proxy", zap.Error(err))
 	}
 
-	botToken := os.Getenv("BOT_TOKEN")
-	GuildID := os.Getenv("GUILD_ID")
-
 	var s *discordgo.Session
-	s, err = discordgo.New("Bot " + botToken)
+	s, err = discordgo.New("Bot " + config.BotToken)
 	if err != nil {
 		log.Fatal("Invalid bot parameters", zap.Error(err))
 	}
 
-	cc, err := NewCampgroundCollection(ctx, log, s, s.Client)
+	providers := NewProviderRegistry(
+		NewRecreationGovProvider(p, s.Client, RecreationGovBaseURL),
+		NewReserveCaliforniaProvider(&http.Client{Timeout: 30 * time.Second}, ReserveCaliforniaBaseURL),
+	)
+
+	cc, err := NewCampgroundCollection(ctx, log, providers)
 	if err != nil {
 		log.Fatal("Cannot get campground collection", zap.Error(err))
 	}
 
-	sc := NewSchniffCollection("schniffs.json")
+	schniffStore, err := OpenSchniffStore(config)
+	if err != nil {
+		log.Fatal("Cannot open schniff store", zap.Error(err))
+	}
+	defer schniffStore.Close()
+
+	schniffArchive, err := OpenSchniffArchive(config)
+	if err != nil {
+		log.Fatal("Cannot open schniff archive", zap.Error(err))
+	}
+	defer schniffArchive.Close()
+
+	sc, err := NewSchniffCollection(schniffStore, schniffArchive)
+	if err != nil {
+		log.Fatal("Cannot load schniffs", zap.Error(err))
+	}
+
+	snapshotStore, err := NewSnapshotStore(config.SnapshotFile)
+	if err != nil {
+		log.Fatal("Cannot open snapshot store", zap.Error(err))
+	}
+	defer snapshotStore.Close()
+
+	ci := NewCampsiteIndex(providers)
+
+	ps, err := NewPreferenceStore(config.Delivery.PreferencesFile)
+	if err != nil {
+		log.Fatal("Cannot load preferences", zap.Error(err))
+	}
+
+	catalog, err := NewCampsiteCatalog(providers, config.Catalog)
+	if err != nil {
+		log.Fatal("Cannot load campsite details", zap.Error(err))
+	}
+
 	s.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) { log.Info("ready to schniff") })
 	s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		if h, ok := commandHandlers[i.ApplicationCommandData().Name]; ok {
-			h(log, s, i, sc, cc)
+			h(log, s, i, sc, cc, providers, snapshotStore, ci, ps)
 		}
 	})
 	s.AddHandler(HandleGuildMemberAdd)
@@ -53,7 +96,7 @@ func main() {
 	defer s.Close()
 
 	// Register the commands
-	_, err = s.ApplicationCommandBulkOverwrite(s.State.User.ID, GuildID, commands)
+	_, err = s.ApplicationCommandBulkOverwrite(s.State.User.ID, config.GuildID, commands)
 	if err != nil {
 		log.Fatal("Cannot register commands", zap.Error(err))
 	}
@@ -65,13 +108,36 @@ func main() {
 	}
 
 	t := NewTracker()
-	var notificationRecords []NotificationRecord
+	rs, err := NewNotificationRecordStore(config.NotificationRecordsFile, config.RecordRetention)
+	if err != nil {
+		log.Fatal("Cannot load notification records", zap.Error(err))
+	}
+
+	ct := NewChangeTracker(snapshotStore)
+	outbox := NewOutbox(config.NotificationCooldown)
+
+	fr := NewFailureReporter()
+	scheduler := NewScheduler(config.Schedule)
+
+	releaseWindows, err := LoadReleaseWindows(config.Release.WindowsFile)
+	if err != nil {
+		log.Fatal("Cannot load release windows", zap.Error(err))
+	}
+	rw, err := NewReleaseWatcher(releaseWindows, config.Release)
+	if err != nil {
+		log.Fatal("Cannot load release reminders", zap.Error(err))
+	}
+
+	// everyone gets notified on discord, and by email too if they opted in and there's a mail server
+	notifiers := []Notifier{NewDiscordNotifier(s, sc, providers, ps, config.Delivery.Channel)}
+	if config.SMTP.Host != "" {
+		notifiers = append(notifiers, NewEmailNotifier(config.SMTP, sc, providers))
+	}
 
 	go func() {
-		ticker := time.NewTicker(15 * time.Second)
+		ticker := time.NewTicker(config.PollInterval)
 		for {
-			newNotificationRecords := loop(ctx, log, s, sc, t, p, notificationRecords)
-			notificationRecords = append(notificationRecords, newNotificationRecords...)
+			loop(ctx, log, s, sc, t, providers, rs, ct, outbox, fr, scheduler, rw, ci, catalog, ps, notifiers, config.Fetch, config.Delivery)
 			select {
 			case <-ticker.C:
 			case <-ctx.Done():
@@ -81,6 +147,49 @@ func main() {
 		}
 	}()
 
+	lifecycleLocation, err := time.LoadLocation(config.Lifecycle.Timezone)
+	if err != nil {
+		log.Fatal("Invalid lifecycle timezone", zap.Error(err))
+	}
+	go func() {
+		ticker := time.NewTicker(config.Lifecycle.Interval)
+		for {
+			lifecycle(log, s, sc, lifecycleLocation)
+
+			// heatmaps read every transition at a campground, so don't let them grow forever
+			pruned, err := snapshotStore.PruneTransitions(time.Now().Add(-config.TransitionRetention))
+			if err != nil {
+				log.Error("Unable to prune transitions", zap.Error(err))
+			}
+			if pruned > 0 {
+				log.Debug("pruned transitions", zap.Int("pruned", pruned))
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(config.Catalog.Interval)
+		for {
+			refreshed, err := catalog.Refresh(ctx, log, sc, time.Now())
+			if err != nil {
+				log.Error("Unable to refresh campsite details", zap.Error(err))
+			}
+			if refreshed > 0 {
+				log.Info("refreshed campsite details", zap.Int("campgrounds", refreshed))
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	go func() {
 		for {
 			// Calculate next duration
@@ -125,55 +234,111 @@ func main() {
 
 }
 
-type NotificationRecord struct {
-	SchniffID    string
-	CampgroundID string
-	CampsiteID   string
-	TargetDate   time.Time
-	NotifiedAt   time.Time
-}
+func loop(ctx context.Context, olog *zap.Logger, s *discordgo.Session, sc *SchniffCollection, t *tracker, providers ProviderRegistry, rs *NotificationRecordStore, ct *ChangeTracker, outbox *Outbox, fr *FailureReporter, scheduler *Scheduler, rw *ReleaseWatcher, ci *CampsiteIndex, catalog *CampsiteCatalog, ps *PreferenceStore, notifiers []Notifier, fetchConfig FetchConfig, deliveryConfig DeliveryConfig) {
+	start := time.Now()
+	defer func() {
+		t.RecordCycle(time.Since(start))
+	}()
 
-func loop(ctx context.Context, olog *zap.Logger, s *discordgo.Session, sc *SchniffCollection, t *tracker, p *pc.Client, sentNotifications []NotificationRecord) []NotificationRecord {
-	requests := ConstructAvailabilityRequests(ctx, olog, s.Client, sc, t, time.Now())
+	pruned, err := rs.Prune(sc.ActiveSchniffIDs(), time.Now())
+	if err != nil {
+		olog.Error("Unable to prune notification records", zap.Error(err))
+	}
+	if pruned > 0 {
+		olog.Debug("pruned notification records", zap.Int("pruned", pruned), zap.Int("remaining", rs.Len()))
+	}
+
+	// this has to happen before the scheduler is refreshed so it picks up any boosts
+	reminders := rw.Check(sc, scheduler, time.Now())
+	for _, release := range reminders {
+		sendReleaseReminder(olog, s, sc, providers, rw, release)
+	}
 
-	// Deduplicate requests
-	deduplicatedRequests := DeduplicateAvailabilityRequests(requests)
-	t.IncrementRequests(len(deduplicatedRequests))
+	scheduler.Refresh(sc, t, time.Now())
+	requests := scheduler.Due(time.Now())
+	t.IncrementRequests(len(requests))
+
+	results := DoRequests(ctx, olog, providers, requests, fetchConfig, t)
+	rw.MarkNotYetReleased(results, time.Now())
+	catalog.Annotate(results)
+	scheduler.Record(results, time.Now())
+	ci.Update(results)
+
+	transitions, err := ct.Update(results, time.Now())
+	if err != nil {
+		olog.Error("Unable to store snapshots", zap.Error(err))
+		sendMessageToChannelInAllGuilds(s, "problemos", fmt.Sprintf("Unable to store snapshots: %+v", err))
+	}
+	olog.Debug("detected transitions", zap.Int("transitions", len(transitions)))
+	scheduler.RecordTransitions(transitions)
 
-	availabilities, err := DoRequests(ctx, olog, p, deduplicatedRequests)
+	// a site that has been taken again is worth notifying about if it comes back
+	cleared, err := rs.Clear(transitions)
 	if err != nil {
-		olog.Error("Unable to get availability", zap.Error(err))
-		sendMessageToChannelInAllGuilds(s, "problemos", fmt.Sprintf("Unable to get availability: %+v", err))
-		return nil
+		olog.Error("Unable to clear notification records", zap.Error(err))
+	}
+	if cleared > 0 {
+		olog.Debug("cleared notification records", zap.Int("cleared", cleared))
+	}
+
+	// only tell problemos when a campground starts or stops failing, otherwise it's the same message every cycle
+	newFailures, recovered := fr.Update(results, time.Now())
+	report := FormatFailureReport(newFailures, recovered)
+	if report != "" {
+		sendMessageToChannelInAllGuilds(s, "problemos", report)
 	}
 
-	notifications, records, err := GenerateNotifications(ctx, olog, availabilities, sc, sentNotifications)
+	// check every month we know about for the campgrounds that were polled, not just the months that were due
+	availabilities := scheduler.Availabilities(results)
+
+	notifications, records, err := GenerateNotifications(ctx, olog, availabilities, sc, rs, ct)
 	if err != nil {
 		sendMessageToChannelInAllGuilds(s, "problemos", fmt.Sprintf("Unable to generate notifications: %+v", err))
 		olog.Error("Unable to generate notifications", zap.Error(err))
 	}
 
-	for _, notification := range notifications {
+	// anything still waiting out a cooldown that has been booked since isn't worth sending
+	outbox.Drop(transitions)
 
+	recordsBySchniff := make(map[string][]NotificationRecord)
+	for _, record := range records {
+		recordsBySchniff[record.SchniffID] = append(recordsBySchniff[record.SchniffID], record)
+	}
+	for _, notification := range notifications {
 		schniff, err := sc.GetSchniff(notification.SchniffID)
 		if err != nil {
 			olog.Error("no such schniff", zap.Error(err))
 			continue
 		}
+		outbox.Queue(OutboxItem{
+			UserID:       schniff.UserID,
+			CampgroundID: schniff.CampgroundID,
+			Notification: notification,
+			Records:      recordsBySchniff[notification.SchniffID],
+		})
+	}
 
-		dmChannel, err := s.UserChannelCreate(schniff.UserID)
-		if err != nil {
-			olog.Error("Unable to create dmChannel", zap.Error(err))
-			continue
-		}
-		embeddedContents, err := GenerateDiscordMessageEmbed(sc, notification)
+	// nothing goes out during quiet hours unless it can't wait
+	now := time.Now()
+	hold := func(item OutboxItem) bool {
+		_, quiet := ps.Get(item.UserID).QuietUntil(now)
+		return quiet && !item.Notification.Urgent(now, deliveryConfig.UrgentWithin)
+	}
+
+	var sentRecords []NotificationRecord
+	for _, item := range outbox.Ready(now, hold) {
+		notification := item.Notification
+
+		schniff, err := sc.GetSchniff(notification.SchniffID)
 		if err != nil {
-			olog.Error("Unable to generate embedded message", zap.Error(err))
+			olog.Error("no such schniff", zap.Error(err))
 			continue
 		}
-		_, err = s.ChannelMessageSendEmbeds(dmChannel.ID, []*discordgo.MessageEmbed{embeddedContents})
-		if err != nil {
-			olog.Error("Unable to send embeds", zap.Error(err))
+
+		if !NotifyAll(olog, notifiers, schniff, notification) {
+			if !outbox.Retry(item) {
+				olog.Error("Giving up on notification", zap.String("schniff_id", schniff.SchniffID), zap.Int("attempts", maxSendAttempts))
+			}
 			continue
 		}
 
@@ -185,12 +350,128 @@ func loop(ctx context.Context, olog *zap.Logger, s *discordgo.Session, sc *Schni
 		// 	continue
 		// }
 
-		sendMessageToChannelInAllGuilds(s, "announcements", RandomSillyBroadcast(schniff.UserID))
+		who := fmt.Sprintf("<@%s>", schniff.UserID)
+		if ps.Get(schniff.UserID).HideFromBroadcast {
+			who = "someone"
+		}
+		sendMessageToChannelInAllGuilds(s, "announcements", RandomSillyBroadcast(who))
 
 		// record we sent the notification
 		t.AddNotification(notification)
+		err = sc.MarkNotified(schniff.SchniffID, time.Now())
+		if err != nil {
+			olog.Error("Unable to mark schniff notified", zap.Error(err))
+		}
+		sentRecords = append(sentRecords, item.Records...)
+	}
+
+	err = rs.Add(sentRecords...)
+	if err != nil {
+		olog.Error("Unable to save notification records", zap.Error(err))
+		sendMessageToChannelInAllGuilds(s, "problemos", fmt.Sprintf("Unable to save notification records: %+v", err))
+	}
+}
 
+// lifecycle rolls every schniff forward to today, lets people know when theirs expired without finding
+// anything, and archives the expired ones
+func lifecycle(olog *zap.Logger, s *discordgo.Session, sc *SchniffCollection, location *time.Location) {
+	expired, err := sc.Roll(Today(time.Now(), location))
+	if err != nil {
+		olog.Error("Unable to roll schniffs", zap.Error(err))
+		sendMessageToChannelInAllGuilds(s, "problemos", fmt.Sprintf("Unable to roll schniffs: %+v", err))
+		return
 	}
 
-	return records
+	for _, schniff := range expired {
+		olog.Info("schniff expired", zap.String("schniff_id", schniff.SchniffID), zap.Bool("hit", !schniff.LastNotified.IsZero()))
+		if !schniff.LastNotified.IsZero() {
+			continue
+		}
+
+		dmChannel, err := s.UserChannelCreate(schniff.UserID)
+		if err != nil {
+			olog.Error("Unable to create dmChannel", zap.Error(err))
+			continue
+		}
+		_, err = s.ChannelMessageSend(dmChannel.ID, GenerateExpiryMessage(schniff))
+		if err != nil {
+			olog.Error("Unable to send expiry message", zap.Error(err))
+		}
+	}
+
+	archived, err := sc.ArchiveExpired()
+	if err != nil {
+		olog.Error("Unable to archive schniffs", zap.Error(err))
+		return
+	}
+	if len(archived) > 0 {
+		olog.Info("archived schniffs", zap.Int("archived", len(archived)))
+	}
+}
+
+// deliver sends the notification embed wherever the user wants it. It only fails if it couldn't be sent
+// anywhere.
+func deliver(s *discordgo.Session, preferences Preferences, channelName string, embed *discordgo.MessageEmbed) error {
+	var errs []string
+	sent := false
+
+	if preferences.WantsDM() {
+		dmChannel, err := s.UserChannelCreate(preferences.UserID)
+		if err == nil {
+			_, err = s.ChannelMessageSendEmbeds(dmChannel.ID, []*discordgo.MessageEmbed{embed})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("dm: %s", err))
+		} else {
+			sent = true
+		}
+	}
+
+	if preferences.WantsChannel() {
+		// mentions in embeds don't ping, so the mention goes in the content
+		err := sendComplexToChannelInUserGuilds(s, preferences.UserID, channelName, &discordgo.MessageSend{
+			Content: fmt.Sprintf("<@%s>", preferences.UserID),
+			Embeds:  []*discordgo.MessageEmbed{embed},
+		})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("channel %s: %s", channelName, err))
+		} else {
+			sent = true
+		}
+	}
+
+	if !sent {
+		return fmt.Errorf("couldn't send notification: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func sendReleaseReminder(olog *zap.Logger, s *discordgo.Session, sc *SchniffCollection, providers ProviderRegistry, rw *ReleaseWatcher, release Release) {
+	schniff, err := sc.GetSchniff(release.SchniffID)
+	if err != nil {
+		olog.Error("no such schniff", zap.Error(err))
+		return
+	}
+
+	message, err := GenerateReleaseReminder(sc, providers, release)
+	if err != nil {
+		olog.Error("Unable to generate release reminder", zap.Error(err))
+		return
+	}
+
+	dmChannel, err := s.UserChannelCreate(schniff.UserID)
+	if err != nil {
+		olog.Error("Unable to create dmChannel", zap.Error(err))
+		return
+	}
+	_, err = s.ChannelMessageSend(dmChannel.ID, message)
+	if err != nil {
+		olog.Error("Unable to send release reminder", zap.Error(err))
+		return
+	}
+
+	err = rw.MarkReminded(release, time.Now())
+	if err != nil {
+		olog.Error("Unable to save release reminder", zap.Error(err))
+	}
 }
@@ -87,3 +87,60 @@ func sendEmbedToChannelInAllGuilds(s *discordgo.Session, channelName string, emb
 
 	return nil
 }
+
+// sendComplexToChannelInUserGuilds sends a message that needs content and embeds together, eg a mention that
+// should ping someone alongside an embed. It only goes to the guilds the user is in, so nobody else's guild
+// sees it, and it fails if none of them have the channel.
+func sendComplexToChannelInUserGuilds(s *discordgo.Session, userID, channelName string, data *discordgo.MessageSend) error {
+	// Fetch all guilds (servers) the bot is a member of
+	guilds := s.State.Guilds
+
+	// If there are no guilds, return an error
+	if len(guilds) == 0 {
+		return fmt.Errorf("the bot is not a member of any guilds")
+	}
+
+	sent := 0
+	for _, guild := range guilds {
+		// the state only has the members we've seen, so ask discord about the rest
+		_, err := s.State.Member(guild.ID, userID)
+		if err != nil {
+			_, err = s.GuildMember(guild.ID, userID)
+		}
+		if err != nil {
+			continue
+		}
+
+		// Get all channels for the guild
+		channels, err := s.GuildChannels(guild.ID)
+		if err != nil {
+			return err
+		}
+
+		// Loop through to find the matching one
+		var targetChannel *discordgo.Channel
+		for _, channel := range channels {
+			if channel.Name == channelName {
+				targetChannel = channel
+				break
+			}
+		}
+
+		// If we didn't find the channel, continue to the next guild
+		if targetChannel == nil {
+			continue
+		}
+
+		// Send a message to the target channel
+		_, err = s.ChannelMessageSendComplex(targetChannel.ID, data)
+		if err != nil {
+			return err
+		}
+		sent++
+	}
+
+	if sent == 0 {
+		return fmt.Errorf("none of the user's guilds have a channel called %s", channelName)
+	}
+	return nil
+}
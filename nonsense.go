@@ -52,34 +52,36 @@ func RandomSillyHeader() string {
 
 }
 
-func RandomSillyBroadcast(userID string) string {
+// RandomSillyBroadcast announces that who got a notification. who is a mention, or anything else for people
+// who don't want to be mentioned.
+func RandomSillyBroadcast(who string) string {
 	src := rand.NewSource(time.Now().UnixNano())
 	r := rand.New(src)
 
 	greetings := []string{
-		"I came, I saw, I schniffed <@%s> a campsite. ",
-		"If schniffing were an olympic sport, <@%s> would be Steven Bradbury since I just found them a campsite.",
-		"When you stare into the schniff, the schniff stares back. Is what <@%s> is saying right now because I found them a campsite.",
-		"These messages are not generated by chatgpt. Neither is the campsite I just found for <@%s>.",
-		"<@%s>'s the name, schniffing them a campsite is the game.",
-		"<@%s> is thinking, why am I getting so many notifications? It's because I just successfully schniffed for them.",
-		"Can <@%s> remember their recreation.gov login credentials? They'll need them to book the campsite I just found for them in time.",
-		"That's one small schniff for <@%s>, one giant leap for schniffkind.",
-		"The schniff will set <@%s> free. Free to book the campsite I just found for them. But not free, you have to pay.",
-		"The only thing <@%s> has to schniff is schniff itself. And also the campsite I just found for them.",
-		"80%% of success is showing up. The other 20%% is schniffing. <@%s> is now 100%% successful.",
-		"Frankly, my dear, I don't give a schniff. But I did give a campsite to <@%s>.",
-		"Hell is other schniffers. But heaven is a campsite I just found for <@%s>.",
-		"I love the smell of schniff in the morning. It smells like <@%s>'s available campsite.",
-		"If you want something done right, you have to do it yourself. Or you can just use schniffer and I'll do it for you, like I just did for <@%s>.",
-		"I'm gonna schniff <@%s> a campsite they can't refuse. And actually I just did.",
-		"Go ahead, make my schniff. I just found <@%s> a campsite.",
-		"Tis better to have schniffed and lost than never to have schniffed at all. But <@%s> didn't lose, I just found them a campsite.",
-		"What doesn't schniff you makes you stronger. <@%s> must be very weak since I just schniffed them a campsite.",
+		"I came, I saw, I schniffed %s a campsite. ",
+		"If schniffing were an olympic sport, %s would be Steven Bradbury since I just found them a campsite.",
+		"When you stare into the schniff, the schniff stares back. Is what %s is saying right now because I found them a campsite.",
+		"These messages are not generated by chatgpt. Neither is the campsite I just found for %s.",
+		"%s's the name, schniffing them a campsite is the game.",
+		"%s is thinking, why am I getting so many notifications? It's because I just successfully schniffed for them.",
+		"Can %s remember their recreation.gov login credentials? They'll need them to book the campsite I just found for them in time.",
+		"That's one small schniff for %s, one giant leap for schniffkind.",
+		"The schniff will set %s free. Free to book the campsite I just found for them. But not free, you have to pay.",
+		"The only thing %s has to schniff is schniff itself. And also the campsite I just found for them.",
+		"80%% of success is showing up. The other 20%% is schniffing. %s is now 100%% successful.",
+		"Frankly, my dear, I don't give a schniff. But I did give a campsite to %s.",
+		"Hell is other schniffers. But heaven is a campsite I just found for %s.",
+		"I love the smell of schniff in the morning. It smells like %s's available campsite.",
+		"If you want something done right, you have to do it yourself. Or you can just use schniffer and I'll do it for you, like I just did for %s.",
+		"I'm gonna schniff %s a campsite they can't refuse. And actually I just did.",
+		"Go ahead, make my schniff. I just found %s a campsite.",
+		"Tis better to have schniffed and lost than never to have schniffed at all. But %s didn't lose, I just found them a campsite.",
+		"What doesn't schniff you makes you stronger. %s must be very weak since I just schniffed them a campsite.",
 	}
 
 	// Choose a random greeting template
 	template := greetings[r.Intn(len(greetings))]
-	return fmt.Sprintf(template, userID)
+	return fmt.Sprintf(template, who)
 
 }
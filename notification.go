@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -11,11 +12,113 @@ import (
 type Notification struct {
 	AvailableCampsites []CampsiteAvailability
 	SchniffID          string
+	// Stays are the stays found for a flexible schniff. The nights of every stay are also in AvailableCampsites.
+	Stays []Stay `json:",omitempty"`
+}
+
+// Urgent is whether any of the nights in the notification are within of now, so it can't wait until morning
+func (n Notification) Urgent(now time.Time, within time.Duration) bool {
+	for _, availability := range n.AvailableCampsites {
+		if availability.Date.Before(now.Add(within)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stay is a booking a flexible schniff could make at a campsite, in on CheckIn and out on CheckOut
+type Stay struct {
+	CampsiteID string
+	CheckIn    time.Time
+	CheckOut   time.Time
+}
+
+// Nights returns how many nights the stay covers
+func (s Stay) Nights() int {
+	return int(s.CheckOut.Sub(s.CheckIn).Hours() / 24)
+}
+
+func (s Stay) key() string {
+	return s.CampsiteID + "/" + s.CheckIn.Format("2006-01-02") + "/" + s.CheckOut.Format("2006-01-02")
+}
+
+// Covers is whether the night of date is part of the stay
+func (s Stay) Covers(date time.Time) bool {
+	return !date.Before(s.CheckIn) && date.Before(s.CheckOut)
 }
 
 type CampsiteAvailability struct {
 	CampsiteID string
 	Date       time.Time
+	// Site is the name the campground gives the campsite, eg 018, and CampsiteType is what sort of campsite it
+	// is. Both are empty if the provider doesn't say.
+	Site         string `json:",omitempty"`
+	CampsiteType string `json:",omitempty"`
+	// MinNumPeople and MaxNumPeople are the campsite's capacity, zero if the provider doesn't say
+	MinNumPeople int `json:",omitempty"`
+	MaxNumPeople int `json:",omitempty"`
+	// Loop is the part of the campground the campsite is in, empty if the provider doesn't say
+	Loop string `json:",omitempty"`
+	// Details are from the CampsiteCatalog, nil if we don't have them
+	Details *CampsiteDetails `json:",omitempty"`
+}
+
+// capacityString describes how many people fit at a campsite, empty if we don't know
+func capacityString(minNumPeople, maxNumPeople int) string {
+	switch {
+	case maxNumPeople == 0:
+		return ""
+	case minNumPeople > 1:
+		return fmt.Sprintf("%d to %d", minNumPeople, maxNumPeople)
+	}
+	return fmt.Sprintf("up to %d", maxNumPeople)
+}
+
+// campsiteTypeAcronyms stay in capitals when campsite types are tidied up
+var campsiteTypeAcronyms = map[string]struct{}{
+	"RV":  {},
+	"ADA": {},
+}
+
+// campsiteTypeString tidies up campsite types that come through in capitals, eg STANDARD NONELECTRIC
+func campsiteTypeString(campsiteType string) string {
+	if strings.ToUpper(campsiteType) != campsiteType {
+		return campsiteType
+	}
+
+	words := strings.Fields(campsiteType)
+	for i, word := range words {
+		if _, ok := campsiteTypeAcronyms[word]; ok {
+			continue
+		}
+		words[i] = word[:1] + strings.ToLower(word[1:])
+	}
+	return strings.Join(words, " ")
+}
+
+// Name is how the campsite is shown to people, eg Site 018 (Loop MCML, Standard Nonelectric, up to 16). The
+// campsite ID stands in for the site if the provider didn't give us one.
+func (c CampsiteAvailability) Name() string {
+	name := fmt.Sprintf("Site %s", c.Site)
+	if c.Site == "" {
+		name = fmt.Sprintf("Campsite %s", c.CampsiteID)
+	}
+
+	var details []string
+	if c.Loop != "" {
+		details = append(details, fmt.Sprintf("Loop %s", c.Loop))
+	}
+	if c.CampsiteType != "" {
+		details = append(details, campsiteTypeString(c.CampsiteType))
+	}
+	if capacity := capacityString(c.MinNumPeople, c.MaxNumPeople); capacity != "" {
+		details = append(details, capacity)
+	}
+	if len(details) == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s (%s)", name, strings.Join(details, ", "))
 }
 
 type campsiteWithDays struct {
@@ -23,15 +126,121 @@ type campsiteWithDays struct {
 	daysCount  int
 }
 
-func GenerateDiscordMessage(sc *SchniffCollection, notification Notification) (string, error) {
+// groupByLoop puts campsites in the same loop next to each other. Loops keep the order of their best
+// campsite, and campsites keep their order within a loop.
+func groupByLoop(campsites []campsiteWithDays, loops map[string]string) {
+	rank := make(map[string]int)
+	for _, campsite := range campsites {
+		loop := loops[campsite.campsiteID]
+		if _, ok := rank[loop]; !ok {
+			rank[loop] = len(rank)
+		}
+	}
+
+	sort.SliceStable(campsites, func(i, j int) bool {
+		return rank[loops[campsites[i].campsiteID]] < rank[loops[campsites[j].campsiteID]]
+	})
+}
+
+// loopSummary counts the campsites at the start of campsites that are in the same loop as the first
+func loopSummary(campsites []campsiteWithDays, loops map[string]string) string {
+	loop := loops[campsites[0].campsiteID]
+	count := 0
+	for _, campsite := range campsites {
+		if loops[campsite.campsiteID] != loop {
+			break
+		}
+		count++
+	}
+
+	if count == 1 {
+		return "1 campsite"
+	}
+	return fmt.Sprintf("%d campsites", count)
+}
+
+// ConsecutiveRun is a block of back to back available nights at a single campsite.
+// Start and End are both available nights, so a single night has Start equal to End.
+type ConsecutiveRun struct {
+	CampsiteID string
+	Start      time.Time
+	End        time.Time
+}
+
+// Nights returns how many nights the run covers
+func (r ConsecutiveRun) Nights() int {
+	return int(r.End.Sub(r.Start).Hours()/24) + 1
+}
+
+// FindConsecutiveRuns groups available dates into runs of consecutive nights on the same campsite.
+// The runs are returned ordered by campsite and then by start date.
+func FindConsecutiveRuns(availableCampsites []CampsiteAvailability) []ConsecutiveRun {
+	sorted := make([]CampsiteAvailability, len(availableCampsites))
+	copy(sorted, availableCampsites)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].CampsiteID != sorted[j].CampsiteID {
+			return sorted[i].CampsiteID < sorted[j].CampsiteID
+		}
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	var runs []ConsecutiveRun
+	for _, campsite := range sorted {
+		if len(runs) > 0 {
+			last := &runs[len(runs)-1]
+			if last.CampsiteID == campsite.CampsiteID {
+				// duplicate dates don't extend the run
+				if !campsite.Date.After(last.End) {
+					continue
+				}
+				if last.End.AddDate(0, 0, 1).Equal(campsite.Date) {
+					last.End = campsite.Date
+					continue
+				}
+			}
+		}
+		runs = append(runs, ConsecutiveRun{
+			CampsiteID: campsite.CampsiteID,
+			Start:      campsite.Date,
+			End:        campsite.Date,
+		})
+	}
+
+	return runs
+}
+
+// Stays lists every stay of exactly nights in the run that checks in on one of days, or on any day if there
+// are none
+func (r ConsecutiveRun) Stays(days []time.Weekday, nights int) []Stay {
+	allowed := make(map[time.Weekday]struct{})
+	for _, day := range days {
+		allowed[day] = struct{}{}
+	}
+
+	var stays []Stay
+	for checkIn := r.Start; !checkIn.AddDate(0, 0, nights-1).After(r.End); checkIn = checkIn.AddDate(0, 0, 1) {
+		if _, ok := allowed[checkIn.Weekday()]; len(allowed) > 0 && !ok {
+			continue
+		}
+		stays = append(stays, Stay{CampsiteID: r.CampsiteID, CheckIn: checkIn, CheckOut: checkIn.AddDate(0, 0, nights)})
+	}
+
+	return stays
+}
+
+func GenerateDiscordMessage(sc *SchniffCollection, providers ProviderRegistry, notification Notification) (string, error) {
 	var message string
-	baseURL := "https://www.recreation.gov/camping/campsites/"
 
 	schniff, err := sc.GetSchniff(notification.SchniffID)
 	if err != nil {
 		return "", err
 	}
 
+	provider, err := providers.Get(schniff.Provider)
+	if err != nil {
+		return "", err
+	}
+
 	// Create an opening sentence with more details about the campground and the date range
 	message = fmt.Sprintf("Hello %s, here is the availability of campsites for campground %s (ID: %s) from %s to %s:\n",
 		schniff.UserNick,
@@ -74,7 +283,7 @@ func GenerateDiscordMessage(sc *SchniffCollection, notification Notification) (s
 
 	// Add sorted campsites to the message, with available days as percentage
 	for _, campsite := range campsites {
-		campsiteLink := baseURL + campsite.campsiteID
+		campsiteLink := provider.CampsiteURL(schniff.CampgroundID, campsite.campsiteID)
 		availabilityPercentage := float64(campsite.daysCount) / float64(totalDays) * 100
 		message += fmt.Sprintf("%-10s  %.2f%%  %s\n", campsite.campsiteID, availabilityPercentage, campsiteLink)
 	}
@@ -87,31 +296,35 @@ func GenerateDiscordMessage(sc *SchniffCollection, notification Notification) (s
 	return message, nil
 }
 
-func GenerateDiscordMessageEmbed(sc *SchniffCollection, notification Notification) (*discordgo.MessageEmbed, error) {
-	baseURL := "https://www.recreation.gov/camping/campsites/"
-	schniff, err := sc.GetSchniff(notification.SchniffID)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create an opening sentence with more details about the campground and the date range
-	title := fmt.Sprintf("%s\n%s\n%s to %s",
-		RandomSillyHeader(),
-		schniff.CampgroundName,
-		schniff.StartDate.Format("2006-01-02"),
-		schniff.EndDate.Format("2006-01-02"),
-	)
+// CampsiteSummary is everything a notification found at one campsite, ready to show to people
+type CampsiteSummary struct {
+	CampsiteID string
+	Name       string
+	Loop       string
+	// LoopSummary is how many of the summarised campsites are in the loop
+	LoopSummary string
+	Details     string
+	DaysCount   int
+	// Lines are the runs of nights available, or the stays found for flexible schniffs
+	Lines []string
+}
 
-	// Calculate total number of days in the date range
-	totalDays := int(schniff.EndDate.Sub(schniff.StartDate).Hours()/24) + 1
-	// fmt.Println(len(notification.AvailableCampsites))
-	// fmt.Println(totalDays, schniff.EndDate, schniff.StartDate)
-	// Create a map to hold campsite IDs and counts
+// SummariseCampsites ranks the campsites in the notification by days available and keeps the top limit,
+// grouped by loop. It also returns how many campsites there were altogether.
+func SummariseCampsites(notification Notification, limit int) ([]CampsiteSummary, int) {
 	campsiteDayCount := make(map[string]int)
+	names := make(map[string]string)
+	loops := make(map[string]string)
+	details := make(map[string]string)
 
 	// Populate the map with the count of days for each campsite
 	for _, campsite := range notification.AvailableCampsites {
 		campsiteDayCount[campsite.CampsiteID]++
+		names[campsite.CampsiteID] = campsite.Name()
+		loops[campsite.CampsiteID] = campsite.Loop
+		if campsite.Details != nil {
+			details[campsite.CampsiteID] = campsite.Details.String()
+		}
 	}
 
 	// Convert map to a slice
@@ -125,62 +338,118 @@ func GenerateDiscordMessageEmbed(sc *SchniffCollection, notification Notificatio
 		return campsites[i].daysCount > campsites[j].daysCount
 	})
 
-	// Take top 10 campsites
-	remainingSites := 0
-	if len(campsites) > 10 {
-		remainingSites = len(campsites) - 10
-		campsites = campsites[:10]
+	total := len(campsites)
+	if len(campsites) > limit {
+		campsites = campsites[:limit]
+	}
+
+	groupByLoop(campsites, loops)
+
+	// flexible schniffs list the stays found, everything else lists the runs of nights
+	linesByCampsite := make(map[string][]string)
+	for _, run := range FindConsecutiveRuns(notification.AvailableCampsites) {
+		if len(notification.Stays) > 0 {
+			break
+		}
+		linesByCampsite[run.CampsiteID] = append(linesByCampsite[run.CampsiteID], fmt.Sprintf("%s (%s), %s", run.Start.Weekday().String(), run.Start.Format("2006-01-02"), nightsString(run.Nights())))
+	}
+	for _, stay := range notification.Stays {
+		linesByCampsite[stay.CampsiteID] = append(linesByCampsite[stay.CampsiteID], fmt.Sprintf("In %s, out %s", stay.CheckIn.Format("Mon 2006-01-02"), stay.CheckOut.Format("Mon 2006-01-02")))
+	}
+
+	// the campsites are grouped, so each loop's first campsite starts its group
+	loopSummaries := make(map[string]string)
+	for i, campsite := range campsites {
+		if _, ok := loopSummaries[loops[campsite.campsiteID]]; !ok {
+			loopSummaries[loops[campsite.campsiteID]] = loopSummary(campsites[i:], loops)
+		}
+	}
+
+	summaries := make([]CampsiteSummary, len(campsites))
+	for i, campsite := range campsites {
+		summaries[i] = CampsiteSummary{
+			CampsiteID:  campsite.campsiteID,
+			Name:        names[campsite.campsiteID],
+			Loop:        loops[campsite.campsiteID],
+			LoopSummary: loopSummaries[loops[campsite.campsiteID]],
+			Details:     details[campsite.campsiteID],
+			DaysCount:   campsite.daysCount,
+			Lines:       linesByCampsite[campsite.campsiteID],
+		}
+	}
+
+	return summaries, total
+}
+
+func GenerateDiscordMessageEmbed(sc *SchniffCollection, providers ProviderRegistry, notification Notification) (*discordgo.MessageEmbed, error) {
+	schniff, err := sc.GetSchniff(notification.SchniffID)
+	if err != nil {
+		return nil, err
 	}
 
+	provider, err := providers.Get(schniff.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create an opening sentence with more details about the campground and the date range
+	title := fmt.Sprintf("%s\n%s\n%s to %s",
+		RandomSillyHeader(),
+		schniff.CampgroundName,
+		schniff.StartDate.Format("2006-01-02"),
+		schniff.EndDate.Format("2006-01-02"),
+	)
+
+	// Calculate total number of days in the date range
+	totalDays := int(schniff.EndDate.Sub(schniff.StartDate).Hours()/24) + 1
+
+	campsites, totalCampsites := SummariseCampsites(notification, 10)
+
 	// Prepare fields for the embed
-	fields := make([]*discordgo.MessageEmbedField, len(campsites)+1)
+	var fields []*discordgo.MessageEmbedField
 
-	// Add sorted campsites to the fields, with available days as percentage
+	// Add sorted campsites to the fields, listing what's available at each under a heading for its loop
 	for i, campsite := range campsites {
-		campsiteLink := baseURL + campsite.campsiteID
-		daysAvailableString := ""
-		daysCount := 0
-		sort.Slice(notification.AvailableCampsites, func(i, j int) bool {
-			return notification.AvailableCampsites[i].Date.Before(notification.AvailableCampsites[j].Date)
-		})
-		for _, availableCampsite := range notification.AvailableCampsites {
-			if campsite.campsiteID != availableCampsite.CampsiteID {
-				continue
-			}
-			dayOfWeek := availableCampsite.Date.Weekday().String()
-			dateString := availableCampsite.Date.Format("2006-01-02")
-			daysAvailableString += fmt.Sprintf("%s (%s)\n", dayOfWeek, dateString)
-			daysCount++
-			if daysCount == 10 {
-				break
-			}
+		if campsite.Loop != "" && (i == 0 || campsites[i-1].Loop != campsite.Loop) {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:   fmt.Sprintf("Loop %s", campsite.Loop),
+				Value:  campsite.LoopSummary,
+				Inline: false,
+			})
+		}
 
+		campsiteLink := provider.CampsiteURL(schniff.CampgroundID, campsite.CampsiteID)
+		runsAvailableString := ""
+		if campsite.Details != "" {
+			runsAvailableString += fmt.Sprintf("*%s*\n", campsite.Details)
 		}
-		if daysCount < campsite.daysCount {
-			daysAvailableString += fmt.Sprintf("...and %d more", campsite.daysCount-daysCount)
+		for j, line := range campsite.Lines {
+			if j == 10 {
+				runsAvailableString += fmt.Sprintf("...and %d more", len(campsite.Lines)-j)
+				break
+			}
+			runsAvailableString += line + "\n"
 		}
-		fields[i] = &discordgo.MessageEmbedField{
-			Name:   fmt.Sprintf("Campsite %s", campsite.campsiteID),
-			Value:  fmt.Sprintf("[%d of %d days available](%s)\n%s", campsite.daysCount, totalDays, campsiteLink, daysAvailableString),
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   campsite.Name,
+			Value:  fmt.Sprintf("[%d of %d days available](%s)\n%s", campsite.DaysCount, totalDays, campsiteLink, runsAvailableString),
 			Inline: false,
-		}
+		})
 	}
 
 	message := fmt.Sprintf(`<@%s>, I just schniffed some available campsites for you.
-Showing the top %d campsites by days available.
+Showing the top %d campsites by days available, listed as %s.
 %d total campsites with availabilities.`,
 		schniff.UserID,
 		len(campsites),
-		len(campsites)+remainingSites,
+		stayDescription(schniff, notification),
+		totalCampsites,
 	)
 
-	fields[len(campsites)] = &discordgo.MessageEmbedField{
-		Name: "Remember",
-		Value: `- You must act fast to get one of these sites. 
-- The links above take you directly to the campsite page to book. Find the availability and click it.
-- If there are no availabilities when you clicked the link, it is because you were too slow. I do not make mistakes.
-- The recreation.gov mobile app will sometimes open to the last page you were looking at despite clicking a link to a different page. Double check the link has opened correctly.`,
-	}
+	fields = append(fields, &discordgo.MessageEmbedField{
+		Name:  "Remember",
+		Value: reminders(provider),
+	})
 
 	// Create the embed message
 	embed := &discordgo.MessageEmbed{
@@ -192,3 +461,32 @@ Showing the top %d campsites by days available.
 
 	return embed, nil
 }
+
+// stayDescription describes what the listed stays are, eg stays of at least 2 nights
+func stayDescription(schniff *Schniff, notification Notification) string {
+	if len(notification.Stays) > 0 {
+		return fmt.Sprintf("every stay of %s I found", nightsString(notification.Stays[0].Nights()))
+	}
+	return fmt.Sprintf("stays of at least %s", nightsString(schniff.MinimumNights()))
+}
+
+// reminders are the things people forget when booking, as a markdown list
+func reminders(provider Provider) string {
+	reminders := `- You must act fast to get one of these sites. 
+- The links above take you directly to the campsite page to book. Find the availability and click it.
+- If there are no availabilities when you clicked the link, it is because you were too slow. I do not make mistakes.`
+	switch provider.Name() {
+	case ProviderRecreationGov:
+		reminders += "\n- The recreation.gov mobile app will sometimes open to the last page you were looking at despite clicking a link to a different page. Double check the link has opened correctly."
+	case ProviderReserveCalifornia:
+		reminders += "\n- ReserveCalifornia doesn't link to single campsites, so the links take you to the campground. Look for the site number in the grid."
+	}
+	return reminders
+}
+
+func nightsString(nights int) string {
+	if nights == 1 {
+		return "1 night"
+	}
+	return fmt.Sprintf("%d nights", nights)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type NotificationRecord struct {
+	SchniffID    string
+	CampgroundID string
+	CampsiteID   string
+	TargetDate   time.Time
+	NotifiedAt   time.Time
+}
+
+// RecordRetention decides how long notification records are kept around for
+type RecordRetention struct {
+	// PastDateGrace is how long after the night of its target date a record is kept
+	PastDateGrace time.Duration
+	// KeepStoppedSchniffs keeps records for schniffs that are no longer active. Dropping them means a
+	// restarted schniff notifies about everything again.
+	KeepStoppedSchniffs bool
+}
+
+type notificationRecordKey struct {
+	schniffID    string
+	campgroundID string
+	campsiteID   string
+	targetDate   string
+}
+
+func keyForRecord(record NotificationRecord) notificationRecordKey {
+	return notificationRecordKey{
+		schniffID:    record.SchniffID,
+		campgroundID: record.CampgroundID,
+		campsiteID:   record.CampsiteID,
+		targetDate:   record.TargetDate.Format("2006-01-02"),
+	}
+}
+
+// NotificationRecordStore remembers what we've already notified people about, and persists it to disk so
+// that a restart doesn't notify everyone about everything again
+type NotificationRecordStore struct {
+	mu           sync.Mutex
+	records      map[notificationRecordKey]NotificationRecord
+	fileLocation string
+	retention    RecordRetention
+}
+
+// NewNotificationRecordStore loads the records at fileLocation if there are any.
+// An empty fileLocation keeps the records in memory only.
+func NewNotificationRecordStore(fileLocation string, retention RecordRetention) (*NotificationRecordStore, error) {
+	rs := &NotificationRecordStore{
+		records:      make(map[notificationRecordKey]NotificationRecord),
+		fileLocation: fileLocation,
+		retention:    retention,
+	}
+	if fileLocation == "" {
+		return rs, nil
+	}
+
+	data, err := os.ReadFile(fileLocation)
+	if os.IsNotExist(err) {
+		return rs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []NotificationRecord
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		rs.records[keyForRecord(record)] = record
+	}
+
+	return rs, nil
+}
+
+// HasBeenNotified checks if the schniff has already been told about the campsite on the date
+func (rs *NotificationRecordStore) HasBeenNotified(schniffID, campgroundID, campsiteID string, targetDate time.Time) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	_, ok := rs.records[notificationRecordKey{
+		schniffID:    schniffID,
+		campgroundID: campgroundID,
+		campsiteID:   campsiteID,
+		targetDate:   targetDate.Format("2006-01-02"),
+	}]
+	return ok
+}
+
+// Add stores the records and writes them to disk
+func (rs *NotificationRecordStore) Add(records ...NotificationRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for _, record := range records {
+		rs.records[keyForRecord(record)] = record
+	}
+
+	return rs.save()
+}
+
+// Prune drops records according to the retention policy. activeSchniffs holds the IDs of all schniffs
+// that are still running.
+func (rs *NotificationRecordStore) Prune(activeSchniffs map[string]struct{}, now time.Time) (int, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	pruned := 0
+	for key, record := range rs.records {
+		// the target date is the night of the stay, so it's over at the start of the next day
+		if now.After(record.TargetDate.AddDate(0, 0, 1).Add(rs.retention.PastDateGrace)) {
+			delete(rs.records, key)
+			pruned++
+			continue
+		}
+
+		if rs.retention.KeepStoppedSchniffs {
+			continue
+		}
+		if _, ok := activeSchniffs[record.SchniffID]; !ok {
+			delete(rs.records, key)
+			pruned++
+		}
+	}
+
+	if pruned == 0 {
+		return 0, nil
+	}
+
+	return pruned, rs.save()
+}
+
+// Clear drops the records for every campsite night that stopped being available, for every schniff. If
+// someone else books a site and then cancels, it's worth telling people about again.
+func (rs *NotificationRecordStore) Clear(transitions []Transition) (int, error) {
+	taken := make(map[string]struct{})
+	for _, transition := range transitions {
+		if transition.From != StateAvailable || transition.To == StateAvailable {
+			continue
+		}
+		taken[transition.CampgroundID+"/"+transition.CampsiteID+"/"+transition.Date.Format("2006-01-02")] = struct{}{}
+	}
+	if len(taken) == 0 {
+		return 0, nil
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	cleared := 0
+	for key := range rs.records {
+		if _, ok := taken[key.campgroundID+"/"+key.campsiteID+"/"+key.targetDate]; !ok {
+			continue
+		}
+		delete(rs.records, key)
+		cleared++
+	}
+
+	if cleared == 0 {
+		return 0, nil
+	}
+
+	return cleared, rs.save()
+}
+
+// Len returns the number of records being kept
+func (rs *NotificationRecordStore) Len() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return len(rs.records)
+}
+
+func (rs *NotificationRecordStore) save() error {
+	if rs.fileLocation == "" {
+		return nil
+	}
+
+	records := make([]NotificationRecord, 0, len(rs.records))
+	for _, record := range rs.records {
+		records = append(records, record)
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(rs.fileLocation), 0755)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a crash mid write doesn't lose everything
+	tmpLocation := rs.fileLocation + ".tmp"
+	err = os.WriteFile(tmpLocation, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpLocation, rs.fileLocation)
+}
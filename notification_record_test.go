@@ -0,0 +1,127 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotificationRecordStore(t *testing.T) {
+	fileLocation := filepath.Join(t.TempDir(), "records.json")
+
+	rs, err := NewNotificationRecordStore(fileLocation, RecordRetention{})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	now := time.Date(2023, 8, 10, 12, 0, 0, 0, time.UTC)
+	records := []NotificationRecord{
+		{SchniffID: "running", CampgroundID: "camp1", CampsiteID: "site1", TargetDate: time.Date(2023, 8, 9, 0, 0, 0, 0, time.UTC)},
+		{SchniffID: "running", CampgroundID: "camp1", CampsiteID: "site1", TargetDate: time.Date(2023, 8, 10, 0, 0, 0, 0, time.UTC)},
+		{SchniffID: "running", CampgroundID: "camp1", CampsiteID: "site1", TargetDate: time.Date(2023, 8, 20, 0, 0, 0, 0, time.UTC)},
+		{SchniffID: "stopped", CampgroundID: "camp1", CampsiteID: "site1", TargetDate: time.Date(2023, 8, 20, 0, 0, 0, 0, time.UTC)},
+	}
+	err = rs.Add(records...)
+	if err != nil {
+		t.Fatalf("Failed to add records: %v", err)
+	}
+
+	// records should survive a restart
+	rs, err = NewNotificationRecordStore(fileLocation, RecordRetention{})
+	if err != nil {
+		t.Fatalf("Failed to reload store: %v", err)
+	}
+	if rs.Len() != len(records) {
+		t.Fatalf("Expected %d records after reload, got %d", len(records), rs.Len())
+	}
+	if !rs.HasBeenNotified("running", "camp1", "site1", time.Date(2023, 8, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected reloaded record to be found")
+	}
+
+	pruned, err := rs.Prune(map[string]struct{}{"running": {}}, now)
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+
+	// the 9th is in the past and the stopped schniff is gone. the 10th is tonight so should be kept.
+	if pruned != 2 {
+		t.Errorf("Expected 2 records pruned, got %d", pruned)
+	}
+	if rs.HasBeenNotified("running", "camp1", "site1", time.Date(2023, 8, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected past record to be pruned")
+	}
+	if !rs.HasBeenNotified("running", "camp1", "site1", time.Date(2023, 8, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected tonight's record to be kept")
+	}
+	if rs.HasBeenNotified("stopped", "camp1", "site1", time.Date(2023, 8, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected stopped schniff's record to be pruned")
+	}
+
+	// pruning should also be persisted
+	rs, err = NewNotificationRecordStore(fileLocation, RecordRetention{})
+	if err != nil {
+		t.Fatalf("Failed to reload store: %v", err)
+	}
+	if rs.Len() != 2 {
+		t.Errorf("Expected 2 records after pruning and reload, got %d", rs.Len())
+	}
+}
+
+func TestNotificationRecordStoreKeepStopped(t *testing.T) {
+	rs, err := NewNotificationRecordStore("", RecordRetention{KeepStoppedSchniffs: true, PastDateGrace: 48 * time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	err = rs.Add(
+		NotificationRecord{SchniffID: "stopped", CampgroundID: "camp1", TargetDate: time.Date(2023, 8, 8, 0, 0, 0, 0, time.UTC)},
+		NotificationRecord{SchniffID: "stopped", CampgroundID: "camp1", TargetDate: time.Date(2023, 8, 5, 0, 0, 0, 0, time.UTC)},
+	)
+	if err != nil {
+		t.Fatalf("Failed to add records: %v", err)
+	}
+
+	pruned, err := rs.Prune(map[string]struct{}{}, time.Date(2023, 8, 10, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("Expected only the record outside the grace period to be pruned, got %d", pruned)
+	}
+}
+
+func TestNotificationRecordStoreClear(t *testing.T) {
+	rs, err := NewNotificationRecordStore("", RecordRetention{})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	date := time.Date(2023, 8, 20, 0, 0, 0, 0, time.UTC)
+	err = rs.Add(
+		NotificationRecord{SchniffID: "schniff1", CampgroundID: "camp1", CampsiteID: "site1", TargetDate: date},
+		NotificationRecord{SchniffID: "schniff2", CampgroundID: "camp1", CampsiteID: "site1", TargetDate: date},
+		NotificationRecord{SchniffID: "schniff1", CampgroundID: "camp1", CampsiteID: "site2", TargetDate: date},
+	)
+	if err != nil {
+		t.Fatalf("Failed to add records: %v", err)
+	}
+
+	cleared, err := rs.Clear([]Transition{
+		{CampgroundID: "camp1", CampsiteID: "site1", Date: date, From: StateAvailable, To: StateReserved},
+		// opening up doesn't clear anything
+		{CampgroundID: "camp1", CampsiteID: "site2", Date: date, From: StateReserved, To: StateAvailable},
+	})
+	if err != nil {
+		t.Fatalf("Failed to clear: %v", err)
+	}
+
+	if cleared != 2 {
+		t.Errorf("Expected the taken site to be cleared for both schniffs, got %d cleared", cleared)
+	}
+	if rs.HasBeenNotified("schniff1", "camp1", "site1", date) {
+		t.Errorf("Expected the taken site to be notified again when it comes back")
+	}
+	if !rs.HasBeenNotified("schniff1", "camp1", "site2", date) {
+		t.Errorf("Expected the other site to stay notified")
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestGenerateNotificationMessage(t *testing.T) {
@@ -21,9 +24,12 @@ func TestGenerateNotificationMessage(t *testing.T) {
 		return
 	}
 
-	sc := NewSchniffCollection("../example_schniffs.json")
+	sc, err := NewSchniffCollection(NewJSONSchniffStore("example_schniffs.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	fmt.Print(GenerateDiscordMessage(sc, notification))
+	fmt.Print(GenerateDiscordMessage(sc, testProviders(), notification))
 }
 
 func TestGenerateNotificationMessageEmbed(t *testing.T) {
@@ -40,9 +46,12 @@ func TestGenerateNotificationMessageEmbed(t *testing.T) {
 		return
 	}
 
-	sc := NewSchniffCollection("../example_schniffs.json")
+	sc, err := NewSchniffCollection(NewJSONSchniffStore("example_schniffs.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	message, err := GenerateDiscordMessageEmbed(sc, notification)
+	message, err := GenerateDiscordMessageEmbed(sc, testProviders(), notification)
 	if err != nil {
 		t.Error(err)
 	}
@@ -54,3 +63,90 @@ func TestGenerateNotificationMessageEmbed(t *testing.T) {
 	}
 
 }
+
+func TestFindConsecutiveRuns(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 8, d, 0, 0, 0, 0, time.UTC) }
+
+	availableCampsites := []CampsiteAvailability{
+		{CampsiteID: "2", Date: day(3)},
+		{CampsiteID: "1", Date: day(2)},
+		{CampsiteID: "1", Date: day(1)},
+		{CampsiteID: "1", Date: day(3)},
+		{CampsiteID: "1", Date: day(3)},
+		{CampsiteID: "1", Date: day(5)},
+		{CampsiteID: "2", Date: day(4)},
+	}
+
+	expected := []ConsecutiveRun{
+		{CampsiteID: "1", Start: day(1), End: day(3)},
+		{CampsiteID: "1", Start: day(5), End: day(5)},
+		{CampsiteID: "2", Start: day(3), End: day(4)},
+	}
+
+	runs := FindConsecutiveRuns(availableCampsites)
+	if diff := cmp.Diff(expected, runs); diff != "" {
+		t.Errorf("Runs mismatch (-want +got):\n%s", diff)
+	}
+
+	nights := []int{3, 1, 2}
+	for i, run := range runs {
+		if run.Nights() != nights[i] {
+			t.Errorf("Expected run %d to be %d nights, got %d", i, nights[i], run.Nights())
+		}
+	}
+}
+
+func TestGroupByLoop(t *testing.T) {
+	campsites := []campsiteWithDays{
+		{campsiteID: "1", daysCount: 5},
+		{campsiteID: "2", daysCount: 4},
+		{campsiteID: "3", daysCount: 3},
+		{campsiteID: "4", daysCount: 2},
+		{campsiteID: "5", daysCount: 1},
+	}
+	loops := map[string]string{"1": "B", "2": "A", "3": "B", "4": "", "5": "A"}
+
+	groupByLoop(campsites, loops)
+
+	var got []string
+	for _, campsite := range campsites {
+		got = append(got, campsite.campsiteID)
+	}
+	if diff := cmp.Diff([]string{"1", "3", "2", "5", "4"}, got); diff != "" {
+		t.Errorf("Campsite order mismatch (-want +got):\n%s", diff)
+	}
+
+	if summary := loopSummary(campsites[2:], loops); summary != "2 campsites" {
+		t.Errorf("Expected loop A to have 2 campsites, got %s", summary)
+	}
+}
+
+func TestCampsiteAvailabilityName(t *testing.T) {
+	tests := []struct {
+		availability CampsiteAvailability
+		expected     string
+	}{
+		{
+			availability: CampsiteAvailability{CampsiteID: "71047", Site: "018", Loop: "MCML", CampsiteType: "STANDARD NONELECTRIC", MaxNumPeople: 16},
+			expected:     "Site 018 (Loop MCML, Standard Nonelectric, up to 16)",
+		},
+		{
+			availability: CampsiteAvailability{CampsiteID: "71048", Site: "B12", CampsiteType: "RV ELECTRIC", MinNumPeople: 2, MaxNumPeople: 8},
+			expected:     "Site B12 (RV Electric, 2 to 8)",
+		},
+		{
+			availability: CampsiteAvailability{CampsiteID: "1042", Site: "42", CampsiteType: "Tent Only"},
+			expected:     "Site 42 (Tent Only)",
+		},
+		{
+			availability: CampsiteAvailability{CampsiteID: "71049"},
+			expected:     "Campsite 71049",
+		},
+	}
+
+	for _, test := range tests {
+		if name := test.availability.Name(); name != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// Notifier is somewhere we can tell the owner of a schniff what it found. Each notifier renders the
+// notification its own way.
+type Notifier interface {
+	// Name identifies the notifier in logs
+	Name() string
+	// Enabled is whether the owner of the schniff wants to hear from this notifier
+	Enabled(schniff *Schniff) bool
+	// Notify renders the notification and sends it to the owner of the schniff
+	Notify(schniff *Schniff, notification Notification) error
+}
+
+// NotifyAll sends the notification through every notifier the owner of the schniff wants. It counts as sent
+// if any of them managed it, so one being down doesn't lose the notification.
+func NotifyAll(log *zap.Logger, notifiers []Notifier, schniff *Schniff, notification Notification) bool {
+	sent := false
+	for _, notifier := range notifiers {
+		if !notifier.Enabled(schniff) {
+			continue
+		}
+		err := notifier.Notify(schniff, notification)
+		if err != nil {
+			log.Error("Unable to send notification", zap.String("notifier", notifier.Name()), zap.String("schniff_id", schniff.SchniffID), zap.Error(err))
+			continue
+		}
+		sent = true
+	}
+	return sent
+}
+
+// DiscordNotifier sends notifications as an embed to a DM, the notification channel or both, depending on the
+// owner's preferences
+type DiscordNotifier struct {
+	s         *discordgo.Session
+	sc        *SchniffCollection
+	providers ProviderRegistry
+	ps        *PreferenceStore
+	channel   string
+}
+
+func NewDiscordNotifier(s *discordgo.Session, sc *SchniffCollection, providers ProviderRegistry, ps *PreferenceStore, channel string) *DiscordNotifier {
+	return &DiscordNotifier{
+		s:         s,
+		sc:        sc,
+		providers: providers,
+		ps:        ps,
+		channel:   channel,
+	}
+}
+
+func (dn *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+// Enabled is always true, everyone hears about their schniffs on discord
+func (dn *DiscordNotifier) Enabled(schniff *Schniff) bool {
+	return true
+}
+
+// Notify sends the embed wherever the owner's preferences say. It only fails if it couldn't be sent anywhere.
+func (dn *DiscordNotifier) Notify(schniff *Schniff, notification Notification) error {
+	embed, err := GenerateDiscordMessageEmbed(dn.sc, dn.providers, notification)
+	if err != nil {
+		return err
+	}
+	return deliver(dn.s, dn.ps.Get(schniff.UserID), dn.channel, embed)
+}
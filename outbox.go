@@ -0,0 +1,246 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutboxItem is a notification waiting to go to a user, along with the records to keep once it has gone
+type OutboxItem struct {
+	UserID       string
+	CampgroundID string
+	Notification Notification
+	Records      []NotificationRecord
+	// Attempts is how many times sending the item has failed
+	Attempts int
+}
+
+// maxSendAttempts is how many times an item is tried before it's given up on, eg for someone whose DMs are
+// closed
+const maxSendAttempts = 5
+
+// Outbox holds notifications so nobody gets more than one every cooldown. Anything that turns up in the
+// meantime is merged in and sent together once the cooldown is up.
+type Outbox struct {
+	cooldown time.Duration
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+	// held is keyed by user then schniff so each schniff gets a single notification
+	held map[string]map[string]*OutboxItem
+}
+
+func NewOutbox(cooldown time.Duration) *Outbox {
+	return &Outbox{
+		cooldown: cooldown,
+		lastSent: make(map[string]time.Time),
+		held:     make(map[string]map[string]*OutboxItem),
+	}
+}
+
+// Queue adds the item, merging it with anything already waiting for the same schniff
+func (o *Outbox) Queue(item OutboxItem) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	userItems, ok := o.held[item.UserID]
+	if !ok {
+		userItems = make(map[string]*OutboxItem)
+		o.held[item.UserID] = userItems
+	}
+
+	existing, ok := userItems[item.Notification.SchniffID]
+	if !ok {
+		userItems[item.Notification.SchniffID] = &item
+		return
+	}
+
+	seen := make(map[string]struct{})
+	for _, availability := range existing.Notification.AvailableCampsites {
+		seen[availability.CampsiteID+availability.Date.String()] = struct{}{}
+	}
+	for _, availability := range item.Notification.AvailableCampsites {
+		if _, ok := seen[availability.CampsiteID+availability.Date.String()]; ok {
+			continue
+		}
+		existing.Notification.AvailableCampsites = append(existing.Notification.AvailableCampsites, availability)
+	}
+
+	seenStays := make(map[string]struct{})
+	for _, stay := range existing.Notification.Stays {
+		seenStays[stay.key()] = struct{}{}
+	}
+	for _, stay := range item.Notification.Stays {
+		if _, ok := seenStays[stay.key()]; ok {
+			continue
+		}
+		existing.Notification.Stays = append(existing.Notification.Stays, stay)
+	}
+	existing.Records = append(existing.Records, item.Records...)
+}
+
+// Retry puts back an item that couldn't be sent so it goes out with the user's next batch. The schniff has
+// already seen these nights, so they'd never be notified again if the item was lost. It returns false once
+// the item has failed maxSendAttempts times and has been given up on.
+func (o *Outbox) Retry(item OutboxItem) bool {
+	item.Attempts++
+	if item.Attempts >= maxSendAttempts {
+		return false
+	}
+	o.Queue(item)
+	return true
+}
+
+// Drop removes every held campsite night that has stopped being available, so people aren't told about
+// sites that went while they were waiting
+func (o *Outbox) Drop(transitions []Transition) {
+	taken := make(map[string]struct{})
+	for _, transition := range transitions {
+		if transition.From != StateAvailable || transition.To == StateAvailable {
+			continue
+		}
+		taken[transition.CampgroundID+"/"+transition.CampsiteID+"/"+transition.Date.Format("2006-01-02")] = struct{}{}
+	}
+	if len(taken) == 0 {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for userID, userItems := range o.held {
+		for schniffID, item := range userItems {
+			if len(item.Notification.Stays) > 0 {
+				dropStays(item, taken)
+			}
+
+			var kept []CampsiteAvailability
+			for _, availability := range item.Notification.AvailableCampsites {
+				if _, ok := taken[item.CampgroundID+"/"+availability.CampsiteID+"/"+availability.Date.Format("2006-01-02")]; ok {
+					continue
+				}
+				kept = append(kept, availability)
+			}
+			item.Notification.AvailableCampsites = kept
+
+			var keptRecords []NotificationRecord
+			for _, record := range item.Records {
+				if _, ok := taken[record.CampgroundID+"/"+record.CampsiteID+"/"+record.TargetDate.Format("2006-01-02")]; ok {
+					continue
+				}
+				keptRecords = append(keptRecords, record)
+			}
+			item.Records = keptRecords
+
+			if len(kept) == 0 {
+				delete(userItems, schniffID)
+			}
+		}
+		if len(userItems) == 0 {
+			delete(o.held, userID)
+		}
+	}
+}
+
+// dropStays removes the stays that include a taken night, along with any nights and records that were only
+// there for them
+func dropStays(item *OutboxItem, taken map[string]struct{}) {
+	var keptStays []Stay
+	for _, stay := range item.Notification.Stays {
+		available := true
+		for date := stay.CheckIn; date.Before(stay.CheckOut); date = date.AddDate(0, 0, 1) {
+			if _, ok := taken[item.CampgroundID+"/"+stay.CampsiteID+"/"+date.Format("2006-01-02")]; ok {
+				available = false
+				break
+			}
+		}
+		if available {
+			keptStays = append(keptStays, stay)
+		}
+	}
+	item.Notification.Stays = keptStays
+
+	covered := func(campsiteID string, date time.Time) bool {
+		for _, stay := range keptStays {
+			if stay.CampsiteID == campsiteID && stay.Covers(date) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var keptNights []CampsiteAvailability
+	for _, availability := range item.Notification.AvailableCampsites {
+		if covered(availability.CampsiteID, availability.Date) {
+			keptNights = append(keptNights, availability)
+		}
+	}
+	item.Notification.AvailableCampsites = keptNights
+
+	var keptRecords []NotificationRecord
+	for _, record := range item.Records {
+		if covered(record.CampsiteID, record.TargetDate) {
+			keptRecords = append(keptRecords, record)
+		}
+	}
+	item.Records = keptRecords
+}
+
+// Ready takes out everything for users whose cooldown is up, and starts their cooldown again. Anything hold
+// returns true for stays where it is, and a user whose items are all held doesn't start a cooldown. A nil
+// hold holds nothing.
+func (o *Outbox) Ready(now time.Time, hold func(item OutboxItem) bool) []OutboxItem {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var ready []OutboxItem
+	for userID, userItems := range o.held {
+		if lastSent, ok := o.lastSent[userID]; ok && now.Sub(lastSent) < o.cooldown {
+			continue
+		}
+		sent := false
+		for schniffID, item := range userItems {
+			if hold != nil && hold(*item) {
+				continue
+			}
+			ready = append(ready, *item)
+			delete(userItems, schniffID)
+			sent = true
+		}
+		if len(userItems) == 0 {
+			delete(o.held, userID)
+		}
+		if sent {
+			o.lastSent[userID] = now
+		}
+	}
+
+	// forget about anyone whose cooldown is over
+	for userID, lastSent := range o.lastSent {
+		if now.Sub(lastSent) >= o.cooldown {
+			delete(o.lastSent, userID)
+		}
+	}
+
+	sort.Slice(ready, func(i, j int) bool {
+		if ready[i].UserID != ready[j].UserID {
+			return ready[i].UserID < ready[j].UserID
+		}
+		return ready[i].Notification.SchniffID < ready[j].Notification.SchniffID
+	})
+
+	return ready
+}
+
+// Len is how many notifications are being held
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	count := 0
+	for _, userItems := range o.held {
+		count += len(userItems)
+	}
+	return count
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOutboxCooldown(t *testing.T) {
+	outbox := NewOutbox(5 * time.Minute)
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	night := func(campsiteID string, day int) CampsiteAvailability {
+		return CampsiteAvailability{CampsiteID: campsiteID, Date: time.Date(2023, 8, day, 0, 0, 0, 0, time.UTC)}
+	}
+	record := func(campsiteID string, day int) NotificationRecord {
+		return NotificationRecord{SchniffID: "schniff1", CampgroundID: "camp1", CampsiteID: campsiteID, TargetDate: time.Date(2023, 8, day, 0, 0, 0, 0, time.UTC)}
+	}
+
+	// the first one goes straight out
+	outbox.Queue(OutboxItem{UserID: "user1", CampgroundID: "camp1", Notification: Notification{SchniffID: "schniff1", AvailableCampsites: []CampsiteAvailability{night("site1", 1)}}})
+	if ready := outbox.Ready(now, nil); len(ready) != 1 {
+		t.Fatalf("Expected the first notification to be ready, got %d", len(ready))
+	}
+
+	// the next few are held and merged
+	outbox.Queue(OutboxItem{UserID: "user1", CampgroundID: "camp1", Notification: Notification{SchniffID: "schniff1", AvailableCampsites: []CampsiteAvailability{night("site2", 1)}}, Records: []NotificationRecord{record("site2", 1)}})
+	outbox.Queue(OutboxItem{UserID: "user1", CampgroundID: "camp1", Notification: Notification{SchniffID: "schniff1", AvailableCampsites: []CampsiteAvailability{night("site2", 1), night("site3", 1)}}, Records: []NotificationRecord{record("site3", 1)}})
+	// other users aren't held up
+	outbox.Queue(OutboxItem{UserID: "user2", CampgroundID: "camp1", Notification: Notification{SchniffID: "schniff2", AvailableCampsites: []CampsiteAvailability{night("site1", 1)}}})
+
+	ready := outbox.Ready(now.Add(time.Minute), nil)
+	if len(ready) != 1 || ready[0].UserID != "user2" {
+		t.Fatalf("Expected only user2 to be ready during user1's cooldown, got %+v", ready)
+	}
+
+	// site3 is booked before the cooldown is up
+	outbox.Drop([]Transition{{CampgroundID: "camp1", CampsiteID: "site3", Date: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC), From: StateAvailable, To: StateReserved}})
+
+	ready = outbox.Ready(now.Add(5*time.Minute), nil)
+	expected := []OutboxItem{
+		{
+			UserID:       "user1",
+			CampgroundID: "camp1",
+			Notification: Notification{SchniffID: "schniff1", AvailableCampsites: []CampsiteAvailability{night("site2", 1)}},
+			Records:      []NotificationRecord{record("site2", 1)},
+		},
+	}
+	if diff := cmp.Diff(expected, ready); diff != "" {
+		t.Errorf("Ready mismatch (-want +got):\n%s", diff)
+	}
+	if outbox.Len() != 0 {
+		t.Errorf("Expected nothing left in the outbox, got %d", outbox.Len())
+	}
+}
+
+func TestOutboxDropStays(t *testing.T) {
+	outbox := NewOutbox(time.Minute)
+	day := func(d int) time.Time { return time.Date(2023, 6, d, 0, 0, 0, 0, time.UTC) }
+
+	var nights []CampsiteAvailability
+	var records []NotificationRecord
+	for d := 5; d <= 8; d++ {
+		nights = append(nights, CampsiteAvailability{CampsiteID: "site1", Date: day(d)})
+		records = append(records, NotificationRecord{SchniffID: "flexible", CampgroundID: "camp1", CampsiteID: "site1", TargetDate: day(d)})
+	}
+	outbox.Queue(OutboxItem{
+		UserID:       "user1",
+		CampgroundID: "camp1",
+		Notification: Notification{
+			SchniffID:          "flexible",
+			AvailableCampsites: nights,
+			Stays: []Stay{
+				{CampsiteID: "site1", CheckIn: day(5), CheckOut: day(7)},
+				{CampsiteID: "site1", CheckIn: day(7), CheckOut: day(9)},
+			},
+		},
+		Records: records,
+	})
+
+	// the 8th going takes the second stay with it, and the 7th goes too since no other stay needs it
+	outbox.Drop([]Transition{{CampgroundID: "camp1", CampsiteID: "site1", Date: day(8), From: StateAvailable, To: StateReserved}})
+
+	ready := outbox.Ready(time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), nil)
+	expected := []OutboxItem{
+		{
+			UserID:       "user1",
+			CampgroundID: "camp1",
+			Notification: Notification{
+				SchniffID:          "flexible",
+				AvailableCampsites: nights[:2],
+				Stays:              []Stay{{CampsiteID: "site1", CheckIn: day(5), CheckOut: day(7)}},
+			},
+			Records: records[:2],
+		},
+	}
+	if diff := cmp.Diff(expected, ready); diff != "" {
+		t.Errorf("Ready mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOutboxHold(t *testing.T) {
+	outbox := NewOutbox(5 * time.Minute)
+	now := time.Date(2023, 7, 1, 3, 0, 0, 0, time.UTC)
+	night := func(campsiteID string, date time.Time) CampsiteAvailability {
+		return CampsiteAvailability{CampsiteID: campsiteID, Date: date}
+	}
+
+	// user1 is asleep, user2 isn't
+	hold := func(item OutboxItem) bool {
+		return item.UserID == "user1" && !item.Notification.Urgent(now, 48*time.Hour)
+	}
+
+	outbox.Queue(OutboxItem{UserID: "user1", Notification: Notification{SchniffID: "later", AvailableCampsites: []CampsiteAvailability{night("site1", time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC))}}})
+	outbox.Queue(OutboxItem{UserID: "user2", Notification: Notification{SchniffID: "other", AvailableCampsites: []CampsiteAvailability{night("site1", time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC))}}})
+
+	ready := outbox.Ready(now, hold)
+	if len(ready) != 1 || ready[0].UserID != "user2" {
+		t.Fatalf("Expected only user2 to be ready, got %+v", ready)
+	}
+
+	// tomorrow night can't wait until morning
+	outbox.Queue(OutboxItem{UserID: "user1", Notification: Notification{SchniffID: "tonight", AvailableCampsites: []CampsiteAvailability{night("site2", time.Date(2023, 7, 2, 0, 0, 0, 0, time.UTC))}}})
+	ready = outbox.Ready(now, hold)
+	if len(ready) != 1 || ready[0].Notification.SchniffID != "tonight" {
+		t.Fatalf("Expected the urgent notification to go, got %+v", ready)
+	}
+	if outbox.Len() != 1 {
+		t.Errorf("Expected the other notification to still be held, got %d", outbox.Len())
+	}
+
+	// once quiet hours are over it goes after the cooldown
+	if ready := outbox.Ready(now.Add(time.Minute), nil); len(ready) != 0 {
+		t.Errorf("Expected user1 to be cooling down, got %+v", ready)
+	}
+	ready = outbox.Ready(now.Add(5*time.Minute), nil)
+	if len(ready) != 1 || ready[0].Notification.SchniffID != "later" {
+		t.Errorf("Expected the held notification to go, got %+v", ready)
+	}
+}
+
+func TestOutboxRetry(t *testing.T) {
+	outbox := NewOutbox(5 * time.Minute)
+	now := time.Date(2023, 7, 1, 3, 0, 0, 0, time.UTC)
+	item := OutboxItem{
+		UserID:       "user1",
+		Notification: Notification{SchniffID: "schniff1", AvailableCampsites: []CampsiteAvailability{{CampsiteID: "site1", Date: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)}}},
+		Records:      []NotificationRecord{{SchniffID: "schniff1", CampsiteID: "site1", TargetDate: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	outbox.Queue(item)
+
+	// a failed send comes back after the cooldown with its records, until it's been tried enough
+	for attempt := 1; attempt < maxSendAttempts; attempt++ {
+		ready := outbox.Ready(now, nil)
+		if len(ready) != 1 || len(ready[0].Records) != 1 {
+			t.Fatalf("Expected the item to be ready on attempt %d, got %+v", attempt, ready)
+		}
+		if !outbox.Retry(ready[0]) {
+			t.Fatalf("Expected the item to be retried after attempt %d", attempt)
+		}
+		if ready := outbox.Ready(now.Add(time.Minute), nil); len(ready) != 0 {
+			t.Fatalf("Expected the retry to wait for the cooldown, got %+v", ready)
+		}
+		now = now.Add(5 * time.Minute)
+	}
+
+	ready := outbox.Ready(now, nil)
+	if len(ready) != 1 || outbox.Retry(ready[0]) {
+		t.Errorf("Expected the item to be given up on after %d attempts", maxSendAttempts)
+	}
+	if outbox.Len() != 0 {
+		t.Errorf("Expected nothing left in the outbox, got %d", outbox.Len())
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DeliveryDM      = "dm"
+	DeliveryChannel = "channel"
+	DeliveryBoth    = "both"
+)
+
+// DeliveryConfig controls how notifications get to people
+type DeliveryConfig struct {
+	PreferencesFile string
+	// Channel is where notifications go for people who want them in a channel
+	Channel string
+	// UrgentWithin makes a notification urgent if any of its nights are this close. Urgent notifications are
+	// sent during quiet hours since they'd be gone by morning.
+	UrgentWithin time.Duration
+}
+
+// Preferences are how someone wants to hear about their schniffs
+type Preferences struct {
+	UserID string `json:"user_id"`
+	// Timezone is the IANA timezone quiet hours are in, HeatmapLocation if empty
+	Timezone string `json:"timezone,omitempty"`
+	// QuietStart and QuietEnd are when quiet hours start and end each day, as 15:04. Quiet hours can run past
+	// midnight. There are none if either is empty.
+	QuietStart string `json:"quiet_start,omitempty"`
+	QuietEnd   string `json:"quiet_end,omitempty"`
+	// Delivery is where notifications go, one of the Delivery constants. Empty is DeliveryDM.
+	Delivery string `json:"delivery,omitempty"`
+	// HideFromBroadcast leaves them out of the announcement that goes out when they get a notification
+	HideFromBroadcast bool `json:"hide_from_broadcast,omitempty"`
+}
+
+// Location is the timezone quiet hours are in
+func (p Preferences) Location() (*time.Location, error) {
+	if p.Timezone == "" {
+		return time.LoadLocation(HeatmapLocation)
+	}
+	return time.LoadLocation(p.Timezone)
+}
+
+// Validate checks the timezone, quiet hours and delivery make sense
+func (p Preferences) Validate() error {
+	_, err := p.Location()
+	if err != nil {
+		return fmt.Errorf("unknown timezone %s", p.Timezone)
+	}
+	for _, clock := range []string{p.QuietStart, p.QuietEnd} {
+		if clock == "" {
+			continue
+		}
+		_, err := time.Parse("15:04", clock)
+		if err != nil {
+			return fmt.Errorf("quiet hours need to look like 22:00, not %s", clock)
+		}
+	}
+	switch p.Delivery {
+	case "", DeliveryDM, DeliveryChannel, DeliveryBoth:
+	default:
+		return fmt.Errorf("unknown delivery %s", p.Delivery)
+	}
+	return nil
+}
+
+// WantsDM and WantsChannel are whether notifications go to a DM and to the notification channel
+func (p Preferences) WantsDM() bool {
+	return p.Delivery != DeliveryChannel
+}
+
+func (p Preferences) WantsChannel() bool {
+	return p.Delivery == DeliveryChannel || p.Delivery == DeliveryBoth
+}
+
+// QuietUntil is when quiet hours end, if now is during them
+func (p Preferences) QuietUntil(now time.Time) (time.Time, bool) {
+	if p.QuietStart == "" || p.QuietEnd == "" || p.QuietStart == p.QuietEnd {
+		return time.Time{}, false
+	}
+	location, err := p.Location()
+	if err != nil {
+		return time.Time{}, false
+	}
+	startClock, err := time.Parse("15:04", p.QuietStart)
+	if err != nil {
+		return time.Time{}, false
+	}
+	endClock, err := time.Parse("15:04", p.QuietEnd)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(location)
+	start := time.Date(local.Year(), local.Month(), local.Day(), startClock.Hour(), startClock.Minute(), 0, 0, location)
+	end := time.Date(local.Year(), local.Month(), local.Day(), endClock.Hour(), endClock.Minute(), 0, 0, location)
+
+	if start.Before(end) {
+		if !local.Before(start) && local.Before(end) {
+			return end, true
+		}
+		return time.Time{}, false
+	}
+	// quiet hours run past midnight, so it's either the end of last night's or the start of tonight's
+	if local.Before(end) {
+		return end, true
+	}
+	if !local.Before(start) {
+		return end.AddDate(0, 0, 1), true
+	}
+	return time.Time{}, false
+}
+
+// PreferencesString describes the preferences for the /preferences command
+func PreferencesString(p Preferences) string {
+	location, err := p.Location()
+	timezone := p.Timezone
+	if err == nil {
+		timezone = location.String()
+	}
+
+	quietHours := "None"
+	if p.QuietStart != "" && p.QuietEnd != "" && p.QuietStart != p.QuietEnd {
+		quietHours = fmt.Sprintf("%s to %s", p.QuietStart, p.QuietEnd)
+	}
+
+	delivery := p.Delivery
+	if delivery == "" {
+		delivery = DeliveryDM
+	}
+
+	broadcast := "Yes"
+	if p.HideFromBroadcast {
+		broadcast = "No"
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Timezone: %s\n", timezone))
+	builder.WriteString(fmt.Sprintf("Quiet hours: %s\n", quietHours))
+	builder.WriteString(fmt.Sprintf("Delivery: %s\n", delivery))
+	builder.WriteString(fmt.Sprintf("Mentioned in announcements: %s", broadcast))
+	return builder.String()
+}
+
+// PreferenceStore keeps everyone's preferences in a json file
+type PreferenceStore struct {
+	fileLocation string
+
+	mu          sync.Mutex
+	preferences map[string]Preferences
+}
+
+// NewPreferenceStore loads the preferences in fileLocation, if there are any. An empty fileLocation keeps them
+// in memory only.
+func NewPreferenceStore(fileLocation string) (*PreferenceStore, error) {
+	ps := &PreferenceStore{
+		fileLocation: fileLocation,
+		preferences:  make(map[string]Preferences),
+	}
+	if fileLocation == "" {
+		return ps, nil
+	}
+
+	data, err := os.ReadFile(fileLocation)
+	if os.IsNotExist(err) {
+		return ps, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &ps.preferences)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+// Get gets the user's preferences, or the defaults if they haven't set any
+func (ps *PreferenceStore) Get(userID string) Preferences {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	preferences, ok := ps.preferences[userID]
+	if !ok {
+		return Preferences{UserID: userID}
+	}
+	return preferences
+}
+
+// Set stores the preferences in place of whatever the user had
+func (ps *PreferenceStore) Set(preferences Preferences) error {
+	err := preferences.Validate()
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.preferences[preferences.UserID] = preferences
+	return ps.save()
+}
+
+func (ps *PreferenceStore) save() error {
+	if ps.fileLocation == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(ps.preferences, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(ps.fileLocation), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpLocation := ps.fileLocation + ".tmp"
+	err = os.WriteFile(tmpLocation, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpLocation, ps.fileLocation)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreferencesQuietUntil(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2023, 7, day, hour, minute, 0, 0, location)
+	}
+
+	tests := []struct {
+		name        string
+		preferences Preferences
+		now         time.Time
+		until       time.Time
+		quiet       bool
+	}{
+		{"no quiet hours", Preferences{Timezone: "America/New_York"}, at(1, 3, 0), time.Time{}, false},
+		{"overnight before midnight", Preferences{Timezone: "America/New_York", QuietStart: "22:00", QuietEnd: "07:30"}, at(1, 23, 0), at(2, 7, 30), true},
+		{"overnight after midnight", Preferences{Timezone: "America/New_York", QuietStart: "22:00", QuietEnd: "07:30"}, at(2, 3, 0), at(2, 7, 30), true},
+		{"overnight at the end", Preferences{Timezone: "America/New_York", QuietStart: "22:00", QuietEnd: "07:30"}, at(2, 7, 30), time.Time{}, false},
+		{"overnight during the day", Preferences{Timezone: "America/New_York", QuietStart: "22:00", QuietEnd: "07:30"}, at(2, 12, 0), time.Time{}, false},
+		{"during the day", Preferences{Timezone: "America/New_York", QuietStart: "09:00", QuietEnd: "17:00"}, at(2, 12, 0), at(2, 17, 0), true},
+		{"before the day", Preferences{Timezone: "America/New_York", QuietStart: "09:00", QuietEnd: "17:00"}, at(2, 8, 59), time.Time{}, false},
+		// 03:00 in new york is midnight in los angeles, which is the default
+		{"default timezone", Preferences{QuietStart: "23:00", QuietEnd: "01:00"}, at(2, 3, 0), at(2, 4, 0), true},
+	}
+
+	for _, test := range tests {
+		until, quiet := test.preferences.QuietUntil(test.now)
+		if quiet != test.quiet || !until.Equal(test.until) {
+			t.Errorf("%s: expected %v until %s, got %v until %s", test.name, test.quiet, test.until, quiet, until)
+		}
+	}
+}
+
+func TestPreferenceStore(t *testing.T) {
+	fileLocation := filepath.Join(t.TempDir(), "preferences.json")
+	ps, err := NewPreferenceStore(fileLocation)
+	if err != nil {
+		t.Fatalf("Failed to create preference store: %v", err)
+	}
+
+	if preferences := ps.Get("user1"); preferences.UserID != "user1" || !preferences.WantsDM() || preferences.WantsChannel() {
+		t.Errorf("Expected DM only defaults, got %+v", preferences)
+	}
+
+	for _, invalid := range []Preferences{
+		{UserID: "user1", Timezone: "Mars/Olympus_Mons"},
+		{UserID: "user1", QuietStart: "10pm", QuietEnd: "07:00"},
+		{UserID: "user1", Delivery: "pigeon"},
+	} {
+		if err := ps.Set(invalid); err == nil {
+			t.Errorf("Expected %+v to be invalid", invalid)
+		}
+	}
+
+	err = ps.Set(Preferences{UserID: "user1", Timezone: "Europe/London", QuietStart: "22:00", QuietEnd: "07:00", Delivery: DeliveryBoth, HideFromBroadcast: true})
+	if err != nil {
+		t.Fatalf("Failed to set preferences: %v", err)
+	}
+
+	reloaded, err := NewPreferenceStore(fileLocation)
+	if err != nil {
+		t.Fatalf("Failed to reload preference store: %v", err)
+	}
+	preferences := reloaded.Get("user1")
+	if preferences.Timezone != "Europe/London" || preferences.QuietStart != "22:00" || !preferences.HideFromBroadcast {
+		t.Errorf("Preferences weren't saved, got %+v", preferences)
+	}
+	if !preferences.WantsDM() || !preferences.WantsChannel() {
+		t.Errorf("Expected both DM and channel delivery, got %+v", preferences)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultProvider is used for schniffs and requests made before providers existed, which were all on
+// recreation.gov
+const DefaultProvider = ProviderRecreationGov
+
+// Provider is a booking site that we can schniff campgrounds on
+type Provider interface {
+	// Name identifies the provider. It matches the Source of the provider's campgrounds.
+	Name() string
+	// GetCampgrounds lists every campground the provider has
+	GetCampgrounds(ctx context.Context, log *zap.Logger) ([]SummarisedCampground, error)
+	// GetAvailability gets the availability of every campsite at the campground for the month containing targetTime
+	GetAvailability(ctx context.Context, log *zap.Logger, campgroundID string, targetTime time.Time) (AvailabilityWithID, error)
+	// GetCampsites gets the campsites at a campground, keyed by campsite ID, without their availabilities
+	GetCampsites(ctx context.Context, log *zap.Logger, campgroundID string) (map[string]Campsite, error)
+	// GetCampsiteDetails gets what we know about the equipment and accessibility of the campsites at a
+	// campground, keyed by campsite ID. It's slow and rarely changes, so it goes through the CampsiteCatalog.
+	GetCampsiteDetails(ctx context.Context, log *zap.Logger, campgroundID string) (map[string]CampsiteDetails, error)
+	// CampgroundURL is where a person can go to look at the campground
+	CampgroundURL(campgroundID string) string
+	// CampsiteURL is where a person can go to book the campsite
+	CampsiteURL(campgroundID, campsiteID string) string
+}
+
+// ProviderRegistry holds every provider we know about, keyed by name
+type ProviderRegistry map[string]Provider
+
+func NewProviderRegistry(providers ...Provider) ProviderRegistry {
+	pr := make(ProviderRegistry)
+	for _, provider := range providers {
+		pr[provider.Name()] = provider
+	}
+	return pr
+}
+
+// Get finds the provider by name. An empty name gets the default provider.
+func (pr ProviderRegistry) Get(name string) (Provider, error) {
+	provider, ok := pr[providerOrDefault(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s", name)
+	}
+	return provider, nil
+}
+
+// Names returns the names of all providers in a stable order
+func (pr ProviderRegistry) Names() []string {
+	names := make([]string, 0, len(pr))
+	for name := range pr {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func providerOrDefault(name string) string {
+	if name == "" {
+		return DefaultProvider
+	}
+	return name
+}
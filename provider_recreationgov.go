@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brensch/campbot/stealthing"
+	pc "github.com/brensch/proxy/client"
+	"go.uber.org/zap"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+const (
+	ProviderRecreationGov = "recreation.gov"
+	RecreationGovBaseURL  = "https://www.recreation.gov"
+)
+
+// proxyDoer does requests through the proxies. It's a *pc.Client outside of tests.
+type proxyDoer interface {
+	Do(req *http.Request, log *zap.Logger) (*http.Response, error)
+}
+
+var _ proxyDoer = (*pc.Client)(nil)
+
+// RecreationGovProvider gets campgrounds and availability from recreation.gov. Availability goes through
+// the proxy since that's what gets hammered, the campground search is only done occasionally.
+type RecreationGovProvider struct {
+	proxy   proxyDoer
+	client  *http.Client
+	baseURL string
+}
+
+func NewRecreationGovProvider(proxy proxyDoer, client *http.Client, baseURL string) *RecreationGovProvider {
+	return &RecreationGovProvider{
+		proxy:   proxy,
+		client:  client,
+		baseURL: baseURL,
+	}
+}
+
+func (rp *RecreationGovProvider) Name() string {
+	return ProviderRecreationGov
+}
+
+func (rp *RecreationGovProvider) CampgroundURL(campgroundID string) string {
+	return fmt.Sprintf("https://www.recreation.gov/camping/campgrounds/%s", campgroundID)
+}
+
+func (rp *RecreationGovProvider) CampsiteURL(campgroundID, campsiteID string) string {
+	return fmt.Sprintf("https://www.recreation.gov/camping/campsites/%s", campsiteID)
+}
+
+// GetAvailability ensures that the targettime is snapped to the start of the month, then queries the API for all availabilities at that ground
+func (rp *RecreationGovProvider) GetAvailability(ctx context.Context, olog *zap.Logger, campgroundID string, targetTime time.Time) (AvailabilityWithID, error) {
+	start := time.Now()
+	log := olog.With(
+		zap.String("campground", campgroundID),
+		zap.Time("target_time", targetTime),
+	)
+	log.Debug("getting availability from api")
+	endpoint := fmt.Sprintf("%s/api/camps/availability/campground/%s/month", rp.baseURL, campgroundID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		log.Error("couldn't create request", zap.Error(err))
+		return AvailabilityWithID{}, err
+	}
+
+	// round the time to the start of the target month and put in param "start_date"
+	monthStart := GetStartOfMonth(targetTime)
+
+	// params need to be url encoded. ie base64
+	v := req.URL.Query()
+	v.Add("start_date", monthStart.Format("2006-01-02T15:04:05.000Z"))
+	req.URL.RawQuery = v.Encode()
+
+	retries := 0
+	var availability Availability
+	var res *http.Response
+	var resContents []byte
+
+	for {
+		// err is the last attempt's, so a campground that always fails reports why
+		if retries >= retryLimit {
+			return AvailabilityWithID{}, err
+		}
+		if retries > 0 {
+			log.Debug("retrying request", zap.Int("retries", retries))
+			time.Sleep(time.Duration(retries) * time.Second)
+		}
+
+		res, err = rp.proxy.Do(req, log)
+		if err != nil {
+			log.Error("couldn't do request", zap.Error(err))
+			retries++
+			continue
+		}
+
+		resContents, err = io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			log.Error("couldn't read response", zap.Error(err))
+			retries++
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			log.Warn("got bad statuscode getting availability", zap.Int("status_code", res.StatusCode))
+			log.Debug("body of bad request", zap.String("body", string(resContents)))
+			err = fmt.Errorf("Got bad status code: %d", res.StatusCode)
+			retries++
+			continue
+			// Leaving this as just a warning so that logs don't count as errors until they fail the retry
+		}
+		err = json.Unmarshal(resContents, &availability)
+		if err != nil {
+			log.Error("couldn't unmarshal", zap.Error(err))
+			retries++
+			continue
+		}
+
+		break
+	}
+
+	log.Debug("completed getting availability from api", zap.Duration("duration", time.Since(start)))
+
+	return AvailabilityWithID{Availability: availability, CampgroundID: campgroundID, Provider: ProviderRecreationGov}, nil
+
+}
+
+// GetCampsites uses the current month of availability to find the campsites, since the payload carries
+// everything we know about each campsite
+func (rp *RecreationGovProvider) GetCampsites(ctx context.Context, log *zap.Logger, campgroundID string) (map[string]Campsite, error) {
+	availability, err := rp.GetAvailability(ctx, log, campgroundID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return CampsitesFromAvailability(availability.Availability), nil
+}
+
+type recreationGovCampsiteSearch struct {
+	Campsites []recreationGovCampsite `json:"campsites"`
+	Size      int                     `json:"size"`
+	Total     int                     `json:"total"`
+}
+
+type recreationGovCampsite struct {
+	CampsiteID string `json:"campsite_id"`
+	Accessible bool   `json:"accessible"`
+	Attributes []struct {
+		Name  string `json:"attribute_name"`
+		Value string `json:"attribute_value"`
+	} `json:"attributes"`
+	PermittedEquipment []struct {
+		Name      string  `json:"equipment_name"`
+		MaxLength float64 `json:"max_length"`
+	} `json:"permitted_equipment"`
+}
+
+// details picks out the attributes we filter on. The longest permitted equipment is used when the campsite
+// doesn't list a max vehicle length.
+func (c recreationGovCampsite) details() CampsiteDetails {
+	details := CampsiteDetails{
+		Accessible: c.Accessible,
+	}
+
+	for _, attribute := range c.Attributes {
+		value := strings.TrimSpace(attribute.Value)
+		switch strings.ToLower(attribute.Name) {
+		case "max vehicle length":
+			length, err := strconv.ParseFloat(value, 64)
+			if err == nil {
+				details.MaxVehicleLength = int(length)
+			}
+		case "driveway surface":
+			details.Driveway = value
+		case "shade":
+			details.Shade = value
+		case "pets allowed":
+			details.PetsAllowed = value != "" && !strings.EqualFold(value, "no")
+		case "accessibility":
+			if strings.EqualFold(value, "yes") {
+				details.Accessible = true
+			}
+		}
+	}
+
+	if details.MaxVehicleLength == 0 {
+		for _, equipment := range c.PermittedEquipment {
+			if int(equipment.MaxLength) > details.MaxVehicleLength {
+				details.MaxVehicleLength = int(equipment.MaxLength)
+			}
+		}
+	}
+
+	return details
+}
+
+// GetCampsiteDetails pages through the campsite search for the campground. It's only done every week or so,
+// so like the campground search it doesn't go through the proxy.
+func (rp *RecreationGovProvider) GetCampsiteDetails(ctx context.Context, log *zap.Logger, campgroundID string) (map[string]CampsiteDetails, error) {
+	details := make(map[string]CampsiteDetails)
+	for start := 0; ; {
+		log.Debug("getting campsite details", zap.String("campground", campgroundID), zap.Int("start", start))
+		endpoint := fmt.Sprintf("%s/api/search/campsites?fq=asset_id%%3A%s&size=1000&start=%d", rp.baseURL, campgroundID, start)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", stealthing.RandomUserAgent())
+
+		res, err := rp.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("Got bad status code: %d", res.StatusCode)
+		}
+
+		var page recreationGovCampsiteSearch
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode campsite search: %w", err)
+		}
+
+		for _, campsite := range page.Campsites {
+			details[campsite.CampsiteID] = campsite.details()
+		}
+
+		start += len(page.Campsites)
+		if len(page.Campsites) == 0 || start >= page.Total {
+			break
+		}
+	}
+
+	return details, nil
+}
+
+// CampgroundRequest gets a page of campgrounds. It looks like they forgot to actually apply the limit that you
+// specify, meaning we can get the entire database in one call. Should only do this once every week or so to
+// be kind.
+func (rp *RecreationGovProvider) CampgroundRequest(ctx context.Context, log *zap.Logger, start int) (CampgroundSearchResults, error) {
+	log.Debug("getting campground")
+	endpoint := fmt.Sprintf("https://recreation.gov/api/search?fq=entity_type%%3Acampground&size=100&start=%d", start)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		log.Error("couldn't create request", zap.Error(err))
+		return CampgroundSearchResults{}, err
+	}
+	req.Header.Set("User-Agent", stealthing.RandomUserAgent())
+
+	res, err := rp.client.Do(req)
+	if err != nil {
+		log.Error("couldn't do request", zap.Error(err))
+		return CampgroundSearchResults{}, err
+	}
+	defer res.Body.Close()
+
+	var target CampgroundSearchResults
+	err = json.NewDecoder(res.Body).Decode(&target)
+	if err != nil {
+		log.Error("couldn't decode campground response", zap.Error(err))
+		return CampgroundSearchResults{}, err
+	}
+
+	return target, nil
+}
+
+func SummariseCampground(apiCampground Campground) SummarisedCampground {
+	campground := SummarisedCampground{
+		Source: ProviderRecreationGov,
+
+		ID:         apiCampground.EntityID,
+		Name:       cases.Title(language.Und).String(apiCampground.Name),
+		ParentName: apiCampground.ParentName,
+		Rating:     apiCampground.AverageRating,
+	}
+
+	return campground
+}
+
+// GetCampgrounds iterates through the search api until all campgrounds are retrieved
+func (rp *RecreationGovProvider) GetCampgrounds(ctx context.Context, log *zap.Logger) ([]SummarisedCampground, error) {
+
+	page := 0
+	startingSize := 100
+	size := startingSize
+	var campgrounds []SummarisedCampground
+
+	// 100 indicates that we received a partial page, and are therefore at the end
+	for size == startingSize {
+		log.Debug("getting campground page", zap.Int("page", page))
+		apiCampgrounds, err := rp.CampgroundRequest(ctx, log.With(), page)
+		if err != nil {
+			log.Error("got error getting campgrounds", zap.Error(err))
+			return nil, err
+		}
+		for _, apiCampground := range apiCampgrounds.Results {
+			campgrounds = append(campgrounds, SummariseCampground(apiCampground))
+		}
+
+		size = apiCampgrounds.Size
+		page = page + size
+	}
+
+	return campgrounds, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// directProxy stands in for the proxies, doing requests straight from the client
+type directProxy struct {
+	client *http.Client
+}
+
+func (dp directProxy) Do(req *http.Request, log *zap.Logger) (*http.Response, error) {
+	return dp.client.Do(req)
+}
+
+func TestRecreationGovAvailabilityError(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/api/camps/availability/campground/broken/month" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	rp := NewRecreationGovProvider(directProxy{client: server.Client()}, server.Client(), server.URL)
+	_, err := rp.GetAvailability(context.Background(), zap.NewNop(), "broken", time.Date(2023, 8, 15, 0, 0, 0, 0, time.UTC))
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Expected the bad status code as an error, got %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != retryLimit {
+		t.Errorf("Expected %d attempts, got %d", retryLimit, got)
+	}
+}
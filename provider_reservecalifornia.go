@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brensch/campbot/stealthing"
+	"go.uber.org/zap"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+const (
+	ProviderReserveCalifornia = "reservecalifornia"
+
+	ReserveCaliforniaBaseURL = "https://calirdr.usedirect.com/rdr/rdr"
+)
+
+// ReserveCaliforniaProvider gets campgrounds and availability for California state parks.
+// ReserveCalifornia calls a campground a facility, and a campsite a unit. Facilities live inside places
+// (parks), and the booking page needs both, so campground IDs are "<placeID>-<facilityID>".
+type ReserveCaliforniaProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+func NewReserveCaliforniaProvider(client *http.Client, baseURL string) *ReserveCaliforniaProvider {
+	return &ReserveCaliforniaProvider{
+		client:  client,
+		baseURL: baseURL,
+	}
+}
+
+type reserveCaliforniaPlace struct {
+	PlaceID int    `json:"PlaceId"`
+	Name    string `json:"Name"`
+}
+
+type reserveCaliforniaFacility struct {
+	FacilityID int    `json:"FacilityId"`
+	PlaceID    int    `json:"PlaceId"`
+	Name       string `json:"Name"`
+}
+
+type reserveCaliforniaGridRequest struct {
+	FacilityID        int    `json:"FacilityId"`
+	StartDate         string `json:"StartDate"`
+	EndDate           string `json:"EndDate"`
+	IsADA             bool   `json:"IsADA"`
+	MinVehicleLength  int    `json:"MinVehicleLength"`
+	UnitCategoryID    int    `json:"UnitCategoryId"`
+	UnitTypesGroupIDs []int  `json:"UnitTypesGroupIds"`
+	SleepingUnitID    int    `json:"SleepingUnitId"`
+	WebOnly           bool   `json:"WebOnly"`
+	InSeasonOnly      bool   `json:"InSeasonOnly"`
+}
+
+type reserveCaliforniaGrid struct {
+	Message  string `json:"Message"`
+	Facility struct {
+		FacilityID int                              `json:"FacilityId"`
+		Name       string                           `json:"Name"`
+		Units      map[string]reserveCaliforniaUnit `json:"Units"`
+	} `json:"Facility"`
+}
+
+type reserveCaliforniaUnit struct {
+	UnitID          int                               `json:"UnitId"`
+	Name            string                            `json:"Name"`
+	ShortName       string                            `json:"ShortName"`
+	IsAda           bool                              `json:"IsAda"`
+	AllowWebBooking bool                              `json:"AllowWebBooking"`
+	VehicleLength   int                               `json:"VehicleLength"`
+	UnitTypeName    string                            `json:"UnitTypeName"`
+	Slices          map[string]reserveCaliforniaSlice `json:"Slices"`
+}
+
+type reserveCaliforniaSlice struct {
+	Date          string `json:"Date"`
+	IsFree        bool   `json:"IsFree"`
+	IsBlocked     bool   `json:"IsBlocked"`
+	IsWalkin      bool   `json:"IsWalkin"`
+	ReservationID int    `json:"ReservationId"`
+}
+
+func (rc *ReserveCaliforniaProvider) Name() string {
+	return ProviderReserveCalifornia
+}
+
+func (rc *ReserveCaliforniaProvider) CampgroundURL(campgroundID string) string {
+	placeID, facilityID, _ := strings.Cut(campgroundID, "-")
+	return fmt.Sprintf("https://www.reservecalifornia.com/Web/Default.aspx#!park/%s/%s", placeID, facilityID)
+}
+
+// CampsiteURL goes to the facility since ReserveCalifornia doesn't have pages for single units
+func (rc *ReserveCaliforniaProvider) CampsiteURL(campgroundID, campsiteID string) string {
+	return rc.CampgroundURL(campgroundID)
+}
+
+// GetCampgrounds gets every facility and labels it with the park it's in
+func (rc *ReserveCaliforniaProvider) GetCampgrounds(ctx context.Context, log *zap.Logger) ([]SummarisedCampground, error) {
+	var places []reserveCaliforniaPlace
+	err := rc.getJSON(ctx, log, "/fd/places", &places)
+	if err != nil {
+		log.Error("couldn't get places", zap.Error(err))
+		return nil, err
+	}
+
+	placeNames := make(map[int]string, len(places))
+	for _, place := range places {
+		placeNames[place.PlaceID] = place.Name
+	}
+
+	var facilities []reserveCaliforniaFacility
+	err = rc.getJSON(ctx, log, "/fd/facilities", &facilities)
+	if err != nil {
+		log.Error("couldn't get facilities", zap.Error(err))
+		return nil, err
+	}
+
+	campgrounds := make([]SummarisedCampground, 0, len(facilities))
+	for _, facility := range facilities {
+		campgrounds = append(campgrounds, SummarisedCampground{
+			Source: ProviderReserveCalifornia,
+
+			ID:         fmt.Sprintf("%d-%d", facility.PlaceID, facility.FacilityID),
+			Name:       cases.Title(language.Und).String(facility.Name),
+			ParentName: placeNames[facility.PlaceID],
+		})
+	}
+
+	return campgrounds, nil
+}
+
+// GetAvailability gets the grid of units for the month containing targetTime and converts it into the same
+// shape as recreation.gov's availability
+func (rc *ReserveCaliforniaProvider) GetAvailability(ctx context.Context, olog *zap.Logger, campgroundID string, targetTime time.Time) (AvailabilityWithID, error) {
+	grid, err := rc.getGrid(ctx, olog, campgroundID, targetTime)
+	if err != nil {
+		return AvailabilityWithID{}, err
+	}
+
+	return AvailabilityWithID{
+		CampgroundID: campgroundID,
+		Provider:     ProviderReserveCalifornia,
+		Availability: grid.toAvailability(),
+	}, nil
+}
+
+func (rc *ReserveCaliforniaProvider) GetCampsites(ctx context.Context, log *zap.Logger, campgroundID string) (map[string]Campsite, error) {
+	availability, err := rc.GetAvailability(ctx, log, campgroundID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return CampsitesFromAvailability(availability.Availability), nil
+}
+
+// GetCampsiteDetails reads the details off the units in the current month's grid. ReserveCalifornia only
+// tells us about accessibility and vehicle length.
+func (rc *ReserveCaliforniaProvider) GetCampsiteDetails(ctx context.Context, log *zap.Logger, campgroundID string) (map[string]CampsiteDetails, error) {
+	grid, err := rc.getGrid(ctx, log, campgroundID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return grid.details(), nil
+}
+
+// getGrid gets the grid of units for the month containing targetTime
+func (rc *ReserveCaliforniaProvider) getGrid(ctx context.Context, olog *zap.Logger, campgroundID string, targetTime time.Time) (reserveCaliforniaGrid, error) {
+	start := time.Now()
+	log := olog.With(
+		zap.String("provider", ProviderReserveCalifornia),
+		zap.String("campground", campgroundID),
+		zap.Time("target_time", targetTime),
+	)
+	log.Debug("getting availability from api")
+
+	placeID, facilityID, ok := strings.Cut(campgroundID, "-")
+	if !ok {
+		return reserveCaliforniaGrid{}, fmt.Errorf("invalid reservecalifornia campground id: %s", campgroundID)
+	}
+	_, err := strconv.Atoi(placeID)
+	if err != nil {
+		return reserveCaliforniaGrid{}, fmt.Errorf("invalid reservecalifornia place id %s: %w", placeID, err)
+	}
+	var gridRequest reserveCaliforniaGridRequest
+	gridRequest.FacilityID, err = strconv.Atoi(facilityID)
+	if err != nil {
+		return reserveCaliforniaGrid{}, fmt.Errorf("invalid reservecalifornia facility id %s: %w", facilityID, err)
+	}
+
+	monthStart := GetStartOfMonth(targetTime)
+	gridRequest.StartDate = monthStart.Format("2006-01-02")
+	gridRequest.EndDate = monthStart.AddDate(0, 1, -1).Format("2006-01-02")
+	gridRequest.UnitTypesGroupIDs = []int{}
+	gridRequest.WebOnly = true
+	gridRequest.InSeasonOnly = true
+
+	body, err := json.Marshal(gridRequest)
+	if err != nil {
+		return reserveCaliforniaGrid{}, err
+	}
+
+	retries := 0
+	var grid reserveCaliforniaGrid
+	for {
+		if retries >= retryLimit {
+			return reserveCaliforniaGrid{}, err
+		}
+		if retries > 0 {
+			log.Debug("retrying request", zap.Int("retries", retries))
+			time.Sleep(time.Duration(retries) * time.Second)
+		}
+
+		err = rc.do(ctx, http.MethodPost, "/search/grid", bytes.NewReader(body), &grid)
+		if err != nil {
+			log.Warn("couldn't get grid", zap.Error(err))
+			retries++
+			continue
+		}
+
+		break
+	}
+
+	log.Debug("completed getting availability from api", zap.Duration("duration", time.Since(start)))
+
+	return grid, nil
+}
+
+func (grid reserveCaliforniaGrid) toAvailability() Availability {
+	availability := Availability{
+		Campsites: make(map[string]Campsite, len(grid.Facility.Units)),
+	}
+
+	for _, unit := range grid.Facility.Units {
+		campsiteID := fmt.Sprintf("%d", unit.UnitID)
+		campsite := Campsite{
+			Availabilities: make(map[string]string, len(unit.Slices)),
+			CampsiteID:     campsiteID,
+			CampsiteType:   strings.ToUpper(unit.UnitTypeName),
+			Site:           unit.ShortName,
+			TypeOfUse:      "Overnight",
+		}
+
+		for _, slice := range unit.Slices {
+			date, err := time.Parse("2006-01-02", slice.Date)
+			if err != nil {
+				continue
+			}
+			campsite.Availabilities[date.Format(time.RFC3339)] = slice.state(unit.AllowWebBooking)
+		}
+
+		availability.Campsites[campsiteID] = campsite
+	}
+	availability.Count = len(availability.Campsites)
+
+	return availability
+}
+
+func (grid reserveCaliforniaGrid) details() map[string]CampsiteDetails {
+	details := make(map[string]CampsiteDetails, len(grid.Facility.Units))
+	for _, unit := range grid.Facility.Units {
+		details[fmt.Sprintf("%d", unit.UnitID)] = CampsiteDetails{
+			MaxVehicleLength: unit.VehicleLength,
+			Accessible:       unit.IsAda,
+		}
+	}
+	return details
+}
+
+// state maps a slice onto the states recreation.gov uses so everything downstream treats them the same
+func (slice reserveCaliforniaSlice) state(allowWebBooking bool) string {
+	switch {
+	case slice.IsBlocked:
+		return StateClosed
+	case slice.IsWalkin || !allowWebBooking:
+		return StateNotReservable
+	case slice.IsFree:
+		return StateAvailable
+	}
+	return StateReserved
+}
+
+func (rc *ReserveCaliforniaProvider) getJSON(ctx context.Context, log *zap.Logger, path string, target interface{}) error {
+	log.Debug("getting reservecalifornia catalog", zap.String("path", path))
+	return rc.do(ctx, http.MethodGet, path, nil, target)
+}
+
+func (rc *ReserveCaliforniaProvider) do(ctx context.Context, method, path string, body io.Reader, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, rc.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", stealthing.RandomUserAgent())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := rc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Got bad status code: %d", res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(target)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testProviders has the real providers, which is fine for anything that doesn't make requests
+func testProviders() ProviderRegistry {
+	return NewProviderRegistry(
+		NewRecreationGovProvider(nil, nil, RecreationGovBaseURL),
+	)
+}
+
+// fakeProvider serves canned availabilities keyed by campground ID
+type fakeProvider struct {
+	name           string
+	availabilities map[string]Availability
+	errs           map[string]error
+	delay          time.Duration
+	details        map[string]map[string]CampsiteDetails
+
+	mu          sync.Mutex
+	requests    []AvailabilityRequest
+	inFlight    int
+	maxInFlight int
+}
+
+func (fp *fakeProvider) Name() string {
+	return fp.name
+}
+
+func (fp *fakeProvider) GetCampgrounds(ctx context.Context, log *zap.Logger) ([]SummarisedCampground, error) {
+	var campgrounds []SummarisedCampground
+	for campgroundID := range fp.availabilities {
+		campgrounds = append(campgrounds, SummarisedCampground{ID: campgroundID, Source: fp.name})
+	}
+	return campgrounds, nil
+}
+
+func (fp *fakeProvider) GetAvailability(ctx context.Context, log *zap.Logger, campgroundID string, targetTime time.Time) (AvailabilityWithID, error) {
+	fp.mu.Lock()
+	fp.requests = append(fp.requests, AvailabilityRequest{Provider: fp.name, CampgroundID: campgroundID, TargetTime: targetTime})
+	fp.inFlight++
+	if fp.inFlight > fp.maxInFlight {
+		fp.maxInFlight = fp.inFlight
+	}
+	fp.mu.Unlock()
+
+	time.Sleep(fp.delay)
+
+	fp.mu.Lock()
+	fp.inFlight--
+	fp.mu.Unlock()
+	if err, ok := fp.errs[campgroundID]; ok {
+		return AvailabilityWithID{}, err
+	}
+	return AvailabilityWithID{CampgroundID: campgroundID, Provider: fp.name, Availability: fp.availabilities[campgroundID]}, nil
+}
+
+func (fp *fakeProvider) GetCampsites(ctx context.Context, log *zap.Logger, campgroundID string) (map[string]Campsite, error) {
+	return CampsitesFromAvailability(fp.availabilities[campgroundID]), nil
+}
+
+func (fp *fakeProvider) GetCampsiteDetails(ctx context.Context, log *zap.Logger, campgroundID string) (map[string]CampsiteDetails, error) {
+	if err, ok := fp.errs[campgroundID]; ok {
+		return nil, err
+	}
+	return fp.details[campgroundID], nil
+}
+
+func (fp *fakeProvider) CampgroundURL(campgroundID string) string {
+	return "https://" + fp.name + "/" + campgroundID
+}
+
+func (fp *fakeProvider) CampsiteURL(campgroundID, campsiteID string) string {
+	return "https://" + fp.name + "/" + campgroundID + "/" + campsiteID
+}
+
+func TestProviderRegistry(t *testing.T) {
+	providers := testProviders()
+
+	provider, err := providers.Get("")
+	if err != nil {
+		t.Fatalf("Expected default provider: %v", err)
+	}
+	if provider.Name() != ProviderRecreationGov {
+		t.Errorf("Expected default provider to be %s, got %s", ProviderRecreationGov, provider.Name())
+	}
+
+	_, err = providers.Get("not a provider")
+	if err == nil {
+		t.Errorf("Expected error getting unknown provider")
+	}
+
+	if url := provider.CampsiteURL("232449", "71047"); url != "https://www.recreation.gov/camping/campsites/71047" {
+		t.Errorf("Unexpected campsite url: %s", url)
+	}
+}
+
+func TestDoRequestsRoutesToProvider(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	other := &fakeProvider{name: "other", availabilities: map[string]Availability{"camp1": {}}}
+	providers := NewProviderRegistry(other)
+
+	requests := []AvailabilityRequest{
+		{Provider: "other", CampgroundID: "camp1", TargetTime: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	results := DoRequests(context.Background(), logger, providers, requests, FetchConfig{Concurrency: 2}, NewTracker())
+	if len(results) != 1 || results[0].Err != nil || results[0].Availability.Provider != "other" {
+		t.Errorf("Expected availability from the other provider, got %+v", results)
+	}
+	if len(other.requests) != 1 {
+		t.Errorf("Expected 1 request to the other provider, got %d", len(other.requests))
+	}
+
+	// requests for a provider we don't have should fail
+	results = DoRequests(context.Background(), logger, providers, []AvailabilityRequest{{Provider: "missing", CampgroundID: "camp1"}}, FetchConfig{Concurrency: 2}, NewTracker())
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("Expected error for a request to a missing provider")
+	}
+}
+
+func TestDoRequestsPartialFailure(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	provider := &fakeProvider{
+		name: "fake",
+		availabilities: map[string]Availability{
+			"good1": {Count: 1},
+			"good2": {Count: 2},
+		},
+		errs: map[string]error{"broken": fmt.Errorf("Got bad status code: 500")},
+	}
+	providers := NewProviderRegistry(provider)
+
+	requests := []AvailabilityRequest{
+		{Provider: "fake", CampgroundID: "good1"},
+		{Provider: "fake", CampgroundID: "broken"},
+		{Provider: "fake", CampgroundID: "good2"},
+	}
+
+	results := DoRequests(context.Background(), logger, providers, requests, FetchConfig{Concurrency: 2}, NewTracker())
+	if len(results) != len(requests) {
+		t.Fatalf("Expected a result per request, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Request != requests[i] {
+			t.Errorf("Expected result %d to be for %+v, got %+v", i, requests[i], result.Request)
+		}
+	}
+	if results[1].Err == nil {
+		t.Errorf("Expected broken campground to fail")
+	}
+
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Errorf("Expected the 2 good campgrounds to still come back, got %v and %v", results[0].Err, results[2].Err)
+	}
+}
+
+func TestDoRequestsWorkerPool(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	provider := &fakeProvider{name: "fake", delay: 20 * time.Millisecond}
+	providers := NewProviderRegistry(provider)
+
+	var requests []AvailabilityRequest
+	for i := 0; i < 12; i++ {
+		requests = append(requests, AvailabilityRequest{Provider: "fake", CampgroundID: fmt.Sprintf("camp%d", i)})
+	}
+
+	tr := NewTracker()
+	start := time.Now()
+	results := DoRequests(context.Background(), logger, providers, requests, FetchConfig{Concurrency: 3, Spread: 60 * time.Millisecond}, tr)
+	elapsed := time.Since(start)
+
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("Expected every request to succeed, %s failed: %v", result.Request.CampgroundID, result.Err)
+		}
+	}
+	if provider.maxInFlight > 3 {
+		t.Errorf("Expected at most 3 requests in flight, got %d", provider.maxInFlight)
+	}
+	// 12 requests of 20ms over 3 workers can't take less than 80ms
+	if elapsed < 80*time.Millisecond {
+		t.Errorf("Requests finished too quickly for the pool size: %s", elapsed)
+	}
+	if tr.queueDepthSamples != len(requests) {
+		t.Errorf("Expected a queue depth sample per request, got %d", tr.queueDepthSamples)
+	}
+	// the first request is always picked up before the depth is sampled
+	if tr.MaxQueueDepth >= len(requests) {
+		t.Errorf("Expected the queue depth to exclude requests being worked on, got %d", tr.MaxQueueDepth)
+	}
+
+	// cancelling the context should fail anything that hasn't been sent yet
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = DoRequests(ctx, logger, providers, requests, FetchConfig{Concurrency: 3, Spread: time.Second}, tr)
+	for _, result := range results {
+		if result.Err == nil {
+			t.Errorf("Expected requests to fail after cancelling")
+			break
+		}
+	}
+}
+
+func TestSpreadOffsets(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	spread := 10 * time.Second
+
+	offsets := spreadOffsets(5, spread, r)
+	slot := spread / 5
+	for i, offset := range offsets {
+		if offset < time.Duration(i)*slot || offset >= time.Duration(i+1)*slot {
+			t.Errorf("Offset %d (%s) is outside its slot", i, offset)
+		}
+	}
+
+	for _, offset := range spreadOffsets(3, 0, r) {
+		if offset != 0 {
+			t.Errorf("Expected no offset without a spread, got %s", offset)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// the final image is built from scratch so it has no zoneinfo of its own
+	_ "time/tzdata"
+)
+
+// ReleaseWindow describes when a provider releases dates for booking. Most release on a rolling window, where
+// each date opens a fixed time ahead. Some campgrounds release a whole month at once on a set day instead.
+type ReleaseWindow struct {
+	// LeadMonths and LeadDays are how far ahead of a date it is released
+	LeadMonths int `json:"lead_months"`
+	LeadDays   int `json:"lead_days"`
+	// ReleaseDay releases the whole month on this day of the month, LeadMonths ahead. Zero means rolling.
+	ReleaseDay int `json:"release_day,omitempty"`
+	// Time is the time of day dates are released, as 15:04
+	Time string `json:"time"`
+	// Timezone is the IANA timezone Time is in
+	Timezone string `json:"timezone"`
+
+	clock    time.Time
+	location *time.Location
+}
+
+func (rw *ReleaseWindow) parse() error {
+	var err error
+	rw.clock, err = time.Parse("15:04", rw.Time)
+	if err != nil {
+		return fmt.Errorf("invalid release time %s: %w", rw.Time, err)
+	}
+	rw.location, err = time.LoadLocation(rw.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid release timezone %s: %w", rw.Timezone, err)
+	}
+	return nil
+}
+
+// ReleaseTime is when the night of date can first be booked
+func (rw ReleaseWindow) ReleaseTime(date time.Time) time.Time {
+	var release time.Time
+	if rw.ReleaseDay > 0 {
+		month := GetStartOfMonth(date).AddDate(0, -rw.LeadMonths, 0)
+		release = time.Date(month.Year(), month.Month(), rw.ReleaseDay, 0, 0, 0, 0, time.UTC)
+	} else {
+		release = date.AddDate(0, -rw.LeadMonths, -rw.LeadDays)
+	}
+
+	return time.Date(release.Year(), release.Month(), release.Day(), rw.clock.Hour(), rw.clock.Minute(), 0, 0, rw.location)
+}
+
+// DefaultReleaseWindows are used for any provider that isn't in the release windows file
+var DefaultReleaseWindows = map[string]ReleaseWindow{
+	ProviderRecreationGov:     {LeadMonths: 6, Time: "10:00", Timezone: "America/New_York"},
+	ProviderReserveCalifornia: {LeadMonths: 6, Time: "08:00", Timezone: "America/Los_Angeles"},
+}
+
+// ReleaseWindows holds the release window for every provider, and for campgrounds that don't follow their
+// provider's usual window
+type ReleaseWindows struct {
+	Providers map[string]ReleaseWindow `json:"providers"`
+	// Campgrounds is keyed by provider/campgroundID, eg recreation.gov/232447
+	Campgrounds map[string]ReleaseWindow `json:"campgrounds"`
+}
+
+// LoadReleaseWindows starts from the defaults and overlays whatever is in the file at fileLocation, if there is
+// one
+func LoadReleaseWindows(fileLocation string) (ReleaseWindows, error) {
+	windows := ReleaseWindows{
+		Providers:   make(map[string]ReleaseWindow),
+		Campgrounds: make(map[string]ReleaseWindow),
+	}
+	for provider, window := range DefaultReleaseWindows {
+		windows.Providers[provider] = window
+	}
+
+	if fileLocation != "" {
+		data, err := os.ReadFile(fileLocation)
+		if err != nil && !os.IsNotExist(err) {
+			return ReleaseWindows{}, err
+		}
+		if err == nil {
+			var overrides ReleaseWindows
+			err = json.Unmarshal(data, &overrides)
+			if err != nil {
+				return ReleaseWindows{}, err
+			}
+			for provider, window := range overrides.Providers {
+				windows.Providers[provider] = window
+			}
+			for campground, window := range overrides.Campgrounds {
+				windows.Campgrounds[campground] = window
+			}
+		}
+	}
+
+	for _, group := range []map[string]ReleaseWindow{windows.Providers, windows.Campgrounds} {
+		for name, window := range group {
+			err := window.parse()
+			if err != nil {
+				return ReleaseWindows{}, fmt.Errorf("release window for %s: %w", name, err)
+			}
+			group[name] = window
+		}
+	}
+
+	return windows, nil
+}
+
+// For gets the release window for the campground, falling back to its provider's
+func (rw ReleaseWindows) For(provider, campgroundID string) (ReleaseWindow, bool) {
+	window, ok := rw.Campgrounds[campgroundKey(provider, campgroundID)]
+	if ok {
+		return window, true
+	}
+	window, ok = rw.Providers[providerOrDefault(provider)]
+	return window, ok
+}
+
+// ReleaseConfig controls what happens around release time
+type ReleaseConfig struct {
+	WindowsFile   string
+	RemindersFile string
+	// ReminderLead is how long before a release the owner of the schniff is reminded
+	ReminderLead time.Duration
+	// BoostBefore and BoostAfter are how long either side of a release the campground is polled as often as possible
+	BoostBefore time.Duration
+	BoostAfter  time.Duration
+}
+
+// Release is a set of dates a schniff wants that all become bookable at the same time
+type Release struct {
+	SchniffID string
+	Time      time.Time
+	Dates     []time.Time
+}
+
+// UpcomingReleases finds the releases of the schniff's dates that happen between from and to
+func UpcomingReleases(schniff *Schniff, window ReleaseWindow, from, to time.Time) []Release {
+	releases := make(map[time.Time]*Release)
+	for date := schniff.StartDate; !date.After(schniff.EndDate); date = date.AddDate(0, 0, 1) {
+		releaseTime := window.ReleaseTime(date)
+		if releaseTime.Before(from) || releaseTime.After(to) {
+			continue
+		}
+		release, ok := releases[releaseTime]
+		if !ok {
+			release = &Release{SchniffID: schniff.SchniffID, Time: releaseTime}
+			releases[releaseTime] = release
+		}
+		release.Dates = append(release.Dates, date)
+	}
+
+	upcoming := make([]Release, 0, len(releases))
+	for _, release := range releases {
+		upcoming = append(upcoming, *release)
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].Time.Before(upcoming[j].Time)
+	})
+	return upcoming
+}
+
+// ReleaseWatcher knows when each schniff's dates are released. It reminds people before their dates open
+// and gets the scheduler to hammer the campground while they do.
+type ReleaseWatcher struct {
+	windows ReleaseWindows
+	config  ReleaseConfig
+
+	mu sync.Mutex
+	// reminded holds the releases we've already sent reminders for, keyed by schniff and release time
+	reminded map[string]time.Time
+}
+
+// NewReleaseWatcher loads the reminders that have already been sent from config.RemindersFile. An empty
+// RemindersFile keeps them in memory only.
+func NewReleaseWatcher(windows ReleaseWindows, config ReleaseConfig) (*ReleaseWatcher, error) {
+	rw := &ReleaseWatcher{
+		windows:  windows,
+		config:   config,
+		reminded: make(map[string]time.Time),
+	}
+	if config.RemindersFile == "" {
+		return rw, nil
+	}
+
+	data, err := os.ReadFile(config.RemindersFile)
+	if os.IsNotExist(err) {
+		return rw, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &rw.reminded)
+	if err != nil {
+		return nil, err
+	}
+
+	return rw, nil
+}
+
+func reminderKey(release Release) string {
+	return fmt.Sprintf("%s/%d", release.SchniffID, release.Time.Unix())
+}
+
+// Check boosts the scheduler for every campground with a release coming up or just gone, and returns the
+// releases that people should be reminded about now
+func (rw *ReleaseWatcher) Check(sc *SchniffCollection, scheduler *Scheduler, now time.Time) []Release {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	var reminders []Release
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	for _, schniff := range sc.schniffs {
+		if !schniff.Active {
+			continue
+		}
+		window, ok := rw.windows.For(schniff.ProviderName(), schniff.CampgroundID)
+		if !ok {
+			continue
+		}
+
+		lookahead := rw.config.ReminderLead
+		if rw.config.BoostBefore > lookahead {
+			lookahead = rw.config.BoostBefore
+		}
+		for _, release := range UpcomingReleases(schniff, window, now.Add(-rw.config.BoostAfter), now.Add(lookahead)) {
+			scheduler.Boost(schniff.ProviderName(), schniff.CampgroundID, release.Time.Add(-rw.config.BoostBefore), release.Time.Add(rw.config.BoostAfter))
+
+			if !release.Time.After(now) || release.Time.After(now.Add(rw.config.ReminderLead)) {
+				continue
+			}
+			if _, ok := rw.reminded[reminderKey(release)]; ok {
+				continue
+			}
+			reminders = append(reminders, release)
+		}
+	}
+
+	return reminders
+}
+
+// MarkReminded stores that the reminder went out so it isn't sent again
+func (rw *ReleaseWatcher) MarkReminded(release Release, now time.Time) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.reminded[reminderKey(release)] = release.Time
+
+	// nothing needs remembering once the release is well past
+	for key, releaseTime := range rw.reminded {
+		if now.Sub(releaseTime) > 24*time.Hour {
+			delete(rw.reminded, key)
+		}
+	}
+
+	return rw.save()
+}
+
+// MarkNotYetReleased sets the state of dates that haven't been released yet to NYR. Not every provider tells
+// us a date isn't released, and a date opening for the first time isn't a cancellation.
+func (rw *ReleaseWatcher) MarkNotYetReleased(results []AvailabilityResult, now time.Time) {
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		window, ok := rw.windows.For(result.Request.Provider, result.Request.CampgroundID)
+		if !ok {
+			continue
+		}
+
+		for _, campsite := range result.Availability.Availability.Campsites {
+			for dateString, state := range campsite.Availabilities {
+				if state != StateReserved {
+					continue
+				}
+				date, err := time.Parse(time.RFC3339, dateString)
+				if err != nil {
+					continue
+				}
+				if window.ReleaseTime(date).After(now) {
+					campsite.Availabilities[dateString] = StateNotYetReleased
+				}
+			}
+		}
+	}
+}
+
+func (rw *ReleaseWatcher) save() error {
+	if rw.config.RemindersFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(rw.reminded, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(rw.config.RemindersFile), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpLocation := rw.config.RemindersFile + ".tmp"
+	err = os.WriteFile(tmpLocation, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpLocation, rw.config.RemindersFile)
+}
+
+// GenerateReleaseReminder writes the DM telling someone their dates are about to open
+func GenerateReleaseReminder(sc *SchniffCollection, providers ProviderRegistry, release Release) (string, error) {
+	schniff, err := sc.GetSchniff(release.SchniffID)
+	if err != nil {
+		return "", err
+	}
+	provider, err := providers.Get(schniff.Provider)
+	if err != nil {
+		return "", err
+	}
+
+	dates := make([]string, len(release.Dates))
+	for i, date := range release.Dates {
+		dates[i] = date.Format("Mon Jan 2")
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Heads up, dates for your schniff at %s are released <t:%d:R> (<t:%d:t>).\n", schniff.CampgroundName, release.Time.Unix(), release.Time.Unix()))
+	builder.WriteString(fmt.Sprintf("Opening: %s\n", strings.Join(dates, ", ")))
+	builder.WriteString("Get logged in and have your cart ready, they go in seconds. I'll be checking as fast as I can.\n")
+	builder.WriteString(provider.CampgroundURL(schniff.CampgroundID))
+
+	return builder.String(), nil
+}
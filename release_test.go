@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReleaseTime(t *testing.T) {
+	windows, err := LoadReleaseWindows("")
+	if err != nil {
+		t.Fatalf("Failed to load release windows: %v", err)
+	}
+	rolling, ok := windows.For("", "232447")
+	if !ok {
+		t.Fatalf("Expected a release window for the default provider")
+	}
+
+	monthly := ReleaseWindow{LeadMonths: 5, ReleaseDay: 15, Time: "07:00", Timezone: "America/Los_Angeles"}
+	err = monthly.parse()
+	if err != nil {
+		t.Fatalf("Failed to parse release window: %v", err)
+	}
+
+	newYork, _ := time.LoadLocation("America/New_York")
+	losAngeles, _ := time.LoadLocation("America/Los_Angeles")
+
+	testCases := []struct {
+		name     string
+		window   ReleaseWindow
+		date     time.Time
+		expected time.Time
+	}{
+		{
+			name:     "rolling",
+			window:   rolling,
+			date:     time.Date(2023, 12, 20, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2023, 6, 20, 10, 0, 0, 0, newYork),
+		},
+		{
+			name:     "monthly",
+			window:   monthly,
+			date:     time.Date(2023, 12, 3, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2023, 7, 15, 7, 0, 0, 0, losAngeles),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.window.ReleaseTime(tc.date)
+			if !got.Equal(tc.expected) {
+				t.Errorf("Expected release at %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadReleaseWindowsOverrides(t *testing.T) {
+	fileLocation := filepath.Join(t.TempDir(), "release_windows.json")
+	err := os.WriteFile(fileLocation, []byte(`{
+		"campgrounds": {
+			"recreation.gov/232447": {"lead_months": 5, "release_day": 15, "time": "07:00", "timezone": "America/Los_Angeles"}
+		}
+	}`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write release windows: %v", err)
+	}
+
+	windows, err := LoadReleaseWindows(fileLocation)
+	if err != nil {
+		t.Fatalf("Failed to load release windows: %v", err)
+	}
+
+	window, _ := windows.For(ProviderRecreationGov, "232447")
+	if window.ReleaseDay != 15 {
+		t.Errorf("Expected the campground override, got %+v", window)
+	}
+	window, _ = windows.For(ProviderRecreationGov, "232448")
+	if window.ReleaseDay != 0 || window.LeadMonths != 6 {
+		t.Errorf("Expected the provider default, got %+v", window)
+	}
+	window, _ = windows.For(ProviderReserveCalifornia, "1-2")
+	if window.Timezone != "America/Los_Angeles" {
+		t.Errorf("Expected the reservecalifornia default, got %+v", window)
+	}
+}
+
+func TestReleaseWatcherCheck(t *testing.T) {
+	windows, err := LoadReleaseWindows("")
+	if err != nil {
+		t.Fatalf("Failed to load release windows: %v", err)
+	}
+	config := ReleaseConfig{
+		RemindersFile: filepath.Join(t.TempDir(), "release_reminders.json"),
+		ReminderLead:  time.Hour,
+		BoostBefore:   2 * time.Minute,
+		BoostAfter:    10 * time.Minute,
+	}
+	rw, err := NewReleaseWatcher(windows, config)
+	if err != nil {
+		t.Fatalf("Failed to create release watcher: %v", err)
+	}
+
+	newYork, _ := time.LoadLocation("America/New_York")
+	// dec 20 and 21 are released at 10am eastern on jun 20 and 21
+	sc := newTestSchniffCollection(t,
+		&Schniff{SchniffID: "schniff1", CampgroundID: "camp1", StartDate: time.Date(2023, 12, 20, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2023, 12, 21, 0, 0, 0, 0, time.UTC), Active: true},
+	)
+	scheduler := NewScheduler(SchedulerConfig{MinInterval: 15 * time.Second, MaxInterval: 30 * time.Minute})
+
+	now := time.Date(2023, 6, 20, 9, 30, 0, 0, newYork)
+	reminders := rw.Check(sc, scheduler, now)
+	expected := []Release{
+		{SchniffID: "schniff1", Time: time.Date(2023, 6, 20, 10, 0, 0, 0, newYork), Dates: []time.Time{time.Date(2023, 12, 20, 0, 0, 0, 0, time.UTC)}},
+	}
+	if diff := cmp.Diff(expected, reminders); diff != "" {
+		t.Fatalf("Reminders mismatch (-want +got):\n%s", diff)
+	}
+
+	err = rw.MarkReminded(reminders[0], now)
+	if err != nil {
+		t.Fatalf("Failed to mark reminded: %v", err)
+	}
+
+	// a restart shouldn't send it again
+	rw, err = NewReleaseWatcher(windows, config)
+	if err != nil {
+		t.Fatalf("Failed to create release watcher: %v", err)
+	}
+	if reminders := rw.Check(sc, scheduler, now); len(reminders) != 0 {
+		t.Errorf("Expected no reminders after marking, got %+v", reminders)
+	}
+
+	// the campground is polled as often as possible from just before the release
+	request := AvailabilityRequest{Provider: ProviderRecreationGov, CampgroundID: "camp1", TargetTime: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)}
+	scheduler.Refresh(sc, NewTracker(), now)
+	if got := scheduler.entries[requestKey(request)].Interval; got == scheduler.config.MinInterval {
+		t.Errorf("Expected no boost half an hour before release")
+	}
+	releaseTime := time.Date(2023, 6, 20, 9, 59, 0, 0, newYork)
+	scheduler.Refresh(sc, NewTracker(), releaseTime)
+	if got := scheduler.entries[requestKey(request)].Interval; got != scheduler.config.MinInterval {
+		t.Errorf("Expected boost around release, got interval %s", got)
+	}
+}
+
+func TestMarkNotYetReleased(t *testing.T) {
+	windows, err := LoadReleaseWindows("")
+	if err != nil {
+		t.Fatalf("Failed to load release windows: %v", err)
+	}
+	rw, err := NewReleaseWatcher(windows, ReleaseConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create release watcher: %v", err)
+	}
+
+	results := []AvailabilityResult{
+		{
+			Request: AvailabilityRequest{CampgroundID: "camp1"},
+			Availability: AvailabilityWithID{CampgroundID: "camp1", Availability: Availability{Campsites: map[string]Campsite{
+				"site1": {CampsiteID: "site1", Availabilities: map[string]string{
+					"2023-12-19T00:00:00Z": StateReserved,
+					"2023-12-20T00:00:00Z": StateReserved,
+					"2023-12-21T00:00:00Z": StateReserved,
+					"2023-12-22T00:00:00Z": StateClosed,
+				}},
+			}}},
+		},
+	}
+
+	rw.MarkNotYetReleased(results, time.Date(2023, 6, 20, 15, 0, 0, 0, time.UTC))
+
+	expected := map[string]string{
+		"2023-12-19T00:00:00Z": StateReserved,
+		"2023-12-20T00:00:00Z": StateReserved,
+		"2023-12-21T00:00:00Z": StateNotYetReleased,
+		"2023-12-22T00:00:00Z": StateClosed,
+	}
+	if diff := cmp.Diff(expected, results[0].Availability.Availability.Campsites["site1"].Availabilities); diff != "" {
+		t.Errorf("Availabilities mismatch (-want +got):\n%s", diff)
+	}
+}
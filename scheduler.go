@@ -0,0 +1,354 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SchedulerConfig controls how often each campground month gets polled
+type SchedulerConfig struct {
+	// MinInterval is the most often any one request is polled. There's no point in it being shorter than
+	// the poll interval since that's how often the scheduler is asked what's due.
+	MinInterval time.Duration
+	// MaxInterval is the least often a request is polled, unless the budget forces it to be longer
+	MaxInterval time.Duration
+	// RequestsPerHour is the budget for all providers combined. If the intervals would add up to more than
+	// this, they're all stretched evenly until they fit. Zero means no budget.
+	RequestsPerHour int
+	// CancellationWindow is how far back cancellations count towards polling a campground more often
+	CancellationWindow time.Duration
+}
+
+// scheduleEntry is one campground month that at least one active schniff wants
+type scheduleEntry struct {
+	Request AvailabilityRequest
+	// Schniffs is how many active schniffs want this campground month
+	Schniffs int
+	// Nearest is the earliest date anyone wants in this month
+	Nearest  time.Time
+	Interval time.Duration
+	NextDue  time.Time
+
+	lastPolled time.Time
+	// latest is the last availability we got, if hasLatest is set
+	hasLatest bool
+	latest    AvailabilityWithID
+}
+
+// Scheduler decides which availability requests are due each cycle. Requests for dates coming up soon, that
+// lots of schniffs share, or at campgrounds that have had cancellations recently are polled more often, and
+// everything is kept under the request budget.
+type Scheduler struct {
+	config  SchedulerConfig
+	entries map[string]*scheduleEntry
+	// cancellations holds when we've seen sites free up, by provider and campground
+	cancellations map[string][]time.Time
+	// boosts holds when campgrounds should be polled as often as possible, by provider and campground
+	boosts map[string][]boost
+
+	mutex sync.Mutex
+}
+
+type boost struct {
+	from  time.Time
+	until time.Time
+}
+
+func NewScheduler(config SchedulerConfig) *Scheduler {
+	return &Scheduler{
+		config:        config,
+		entries:       make(map[string]*scheduleEntry),
+		cancellations: make(map[string][]time.Time),
+		boosts:        make(map[string][]boost),
+	}
+}
+
+func requestKey(request AvailabilityRequest) string {
+	return campgroundKey(request.Provider, request.CampgroundID) + "/" + request.TargetTime.Format("2006-01")
+}
+
+func campgroundKey(provider, campgroundID string) string {
+	return providerOrDefault(provider) + "/" + campgroundID
+}
+
+// Refresh works out which campground months the active schniffs want and when each is next due. Requests
+// that nobody wants any more are dropped, and new ones are due straight away.
+func (s *Scheduler) Refresh(sc *SchniffCollection, t *tracker, now time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	wanted := make(map[string]*scheduleEntry)
+
+	sc.mutex.Lock()
+	for _, schniff := range sc.schniffs {
+		if !schniff.Active {
+			continue
+		}
+
+		// track active schniffs and users
+		t.AddActiveSchniff(schniff.SchniffID)
+		t.AddActiveUser(schniff.UserNick)
+		t.AddActiveCampground(schniff.CampgroundName)
+		for date := schniff.StartDate; !date.After(schniff.EndDate); date = date.AddDate(0, 0, 1) {
+			t.AddActiveDay(date)
+		}
+
+		// one request for every month the schniff covers that hasn't already finished
+		for month := GetStartOfMonth(schniff.StartDate); !month.After(schniff.EndDate); month = month.AddDate(0, 1, 0) {
+			if !month.AddDate(0, 1, 0).After(today) {
+				continue
+			}
+
+			nearest := month
+			if schniff.StartDate.After(nearest) {
+				nearest = schniff.StartDate
+			}
+			if today.After(nearest) {
+				nearest = today
+			}
+
+			request := AvailabilityRequest{
+				Provider:     schniff.ProviderName(),
+				CampgroundID: schniff.CampgroundID,
+				TargetTime:   month,
+			}
+			key := requestKey(request)
+			entry, ok := wanted[key]
+			if !ok {
+				entry = &scheduleEntry{Request: request, Nearest: nearest}
+				wanted[key] = entry
+			}
+			entry.Schniffs++
+			if nearest.Before(entry.Nearest) {
+				entry.Nearest = nearest
+			}
+		}
+	}
+	sc.mutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pruneCancellations(now)
+	s.pruneBoosts(now)
+
+	for key, entry := range wanted {
+		existing, ok := s.entries[key]
+		if ok {
+			entry.lastPolled = existing.lastPolled
+			entry.hasLatest = existing.hasLatest
+			entry.latest = existing.latest
+		}
+		entry.Interval = s.interval(entry, now)
+	}
+
+	// stretch everything evenly if we'd go over the budget
+	if s.config.RequestsPerHour > 0 {
+		var perHour float64
+		for _, entry := range wanted {
+			perHour += float64(time.Hour) / float64(entry.Interval)
+		}
+		if perHour > float64(s.config.RequestsPerHour) {
+			stretch := perHour / float64(s.config.RequestsPerHour)
+			for _, entry := range wanted {
+				entry.Interval = time.Duration(float64(entry.Interval) * stretch)
+			}
+		}
+	}
+
+	// boosts are short so they're allowed to go over the budget
+	for _, entry := range wanted {
+		if s.boosted(entry.Request, now) {
+			entry.Interval = s.config.MinInterval
+		}
+	}
+
+	for _, entry := range wanted {
+		if entry.lastPolled.IsZero() {
+			entry.NextDue = now
+			continue
+		}
+		entry.NextDue = entry.lastPolled.Add(entry.Interval)
+	}
+
+	s.entries = wanted
+}
+
+// interval works out how often an entry should be polled before the budget is taken into account
+func (s *Scheduler) interval(entry *scheduleEntry, now time.Time) time.Duration {
+	// dates within the next week get the minimum, then it backs off the further out they are
+	daysAway := entry.Nearest.Sub(now).Hours() / 24
+	interval := float64(s.config.MinInterval) * math.Max(1, daysAway/7)
+
+	// more schniffs wanting it means more people miss out if we're slow
+	interval /= float64(entry.Schniffs)
+
+	// campgrounds that have had cancellations recently are likely to have more
+	cancellations := len(s.cancellations[campgroundKey(entry.Request.Provider, entry.Request.CampgroundID)])
+	interval /= 1 + math.Log2(1+float64(cancellations))
+
+	if interval < float64(s.config.MinInterval) {
+		interval = float64(s.config.MinInterval)
+	}
+	if s.config.MaxInterval > 0 && interval > float64(s.config.MaxInterval) {
+		interval = float64(s.config.MaxInterval)
+	}
+
+	return time.Duration(interval)
+}
+
+func (s *Scheduler) pruneCancellations(now time.Time) {
+	cutoff := now.Add(-s.config.CancellationWindow)
+	for key, times := range s.cancellations {
+		var kept []time.Time
+		for _, seen := range times {
+			if seen.After(cutoff) {
+				kept = append(kept, seen)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.cancellations, key)
+			continue
+		}
+		s.cancellations[key] = kept
+	}
+}
+
+// Boost polls every request for the campground as often as possible between from and until
+func (s *Scheduler) Boost(provider, campgroundID string, from, until time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := campgroundKey(provider, campgroundID)
+	for _, existing := range s.boosts[key] {
+		if existing.from.Equal(from) && existing.until.Equal(until) {
+			return
+		}
+	}
+	s.boosts[key] = append(s.boosts[key], boost{from: from, until: until})
+}
+
+func (s *Scheduler) boosted(request AvailabilityRequest, now time.Time) bool {
+	for _, b := range s.boosts[campgroundKey(request.Provider, request.CampgroundID)] {
+		if !now.Before(b.from) && !now.After(b.until) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scheduler) pruneBoosts(now time.Time) {
+	for key, boosts := range s.boosts {
+		var kept []boost
+		for _, b := range boosts {
+			if !now.After(b.until) {
+				kept = append(kept, b)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.boosts, key)
+			continue
+		}
+		s.boosts[key] = kept
+	}
+}
+
+// Due returns the requests that should be done now, most overdue first
+func (s *Scheduler) Due(now time.Time) []AvailabilityRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var due []*scheduleEntry
+	for _, entry := range s.entries {
+		if entry.NextDue.After(now) {
+			continue
+		}
+		due = append(due, entry)
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextDue.Equal(due[j].NextDue) {
+			return due[i].NextDue.Before(due[j].NextDue)
+		}
+		return requestKey(due[i].Request) < requestKey(due[j].Request)
+	})
+
+	requests := make([]AvailabilityRequest, len(due))
+	for i, entry := range due {
+		requests[i] = entry.Request
+	}
+	return requests
+}
+
+// Record pushes back the next poll of every request that was attempted, and keeps the latest availability
+// of the successful ones
+func (s *Scheduler) Record(results []AvailabilityResult, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, result := range results {
+		entry, ok := s.entries[requestKey(result.Request)]
+		if !ok {
+			continue
+		}
+
+		// failures wait their turn too, otherwise a broken campground would be hammered every cycle
+		entry.lastPolled = now
+		entry.NextDue = now.Add(entry.Interval)
+		if result.Err != nil {
+			continue
+		}
+
+		entry.hasLatest = true
+		entry.latest = result.Availability
+	}
+}
+
+// Availabilities returns the latest availability of every month we have for the campgrounds in results that
+// succeeded. Schniffs can span months that aren't due at the same time, so this keeps runs across the end
+// of a month whole.
+func (s *Scheduler) Availabilities(results []AvailabilityResult) []AvailabilityWithID {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fresh := make(map[string]struct{})
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		fresh[campgroundKey(result.Request.Provider, result.Request.CampgroundID)] = struct{}{}
+	}
+
+	var keys []string
+	for key, entry := range s.entries {
+		if !entry.hasLatest {
+			continue
+		}
+		if _, ok := fresh[campgroundKey(entry.Request.Provider, entry.Request.CampgroundID)]; !ok {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	availabilities := make([]AvailabilityWithID, len(keys))
+	for i, key := range keys {
+		availabilities[i] = s.entries[key].latest
+	}
+	return availabilities
+}
+
+// RecordTransitions counts every campsite night that went from reserved to available as a cancellation.
+// Dates being released for the first time go from NYR and don't count.
+func (s *Scheduler) RecordTransitions(transitions []Transition) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, transition := range transitions {
+		if transition.From != StateReserved || transition.To != StateAvailable {
+			continue
+		}
+		key := campgroundKey(transition.Provider, transition.CampgroundID)
+		s.cancellations[key] = append(s.cancellations[key], transition.At)
+	}
+}
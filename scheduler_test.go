@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestSchniffCollection(t *testing.T, schniffs ...*Schniff) *SchniffCollection {
+	sc, err := NewSchniffCollection(NewJSONSchniffStore(filepath.Join(t.TempDir(), "schniffs.json")), nil)
+	if err != nil {
+		t.Fatalf("Failed to create schniff collection: %v", err)
+	}
+	for _, schniff := range schniffs {
+		err = sc.Add(schniff)
+		if err != nil {
+			t.Fatalf("Failed to add schniff: %v", err)
+		}
+	}
+	return sc
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	config := SchedulerConfig{
+		MinInterval: 15 * time.Second,
+		MaxInterval: 30 * time.Minute,
+	}
+
+	sc := newTestSchniffCollection(t,
+		// next week, shared by two schniffs
+		&Schniff{SchniffID: "soon1", CampgroundID: "near", StartDate: now.AddDate(0, 0, 2), EndDate: now.AddDate(0, 0, 4), Active: true},
+		&Schniff{SchniffID: "soon2", CampgroundID: "near", StartDate: now.AddDate(0, 0, 3), EndDate: now.AddDate(0, 0, 5), Active: true},
+		// a few months out
+		&Schniff{SchniffID: "later", CampgroundID: "far", StartDate: time.Date(2023, 9, 10, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2023, 9, 12, 0, 0, 0, 0, time.UTC), Active: true},
+		// stopped schniffs aren't polled at all
+		&Schniff{SchniffID: "stopped", CampgroundID: "gone", StartDate: now, EndDate: now.AddDate(0, 0, 1)},
+	)
+
+	scheduler := NewScheduler(config)
+	scheduler.Refresh(sc, NewTracker(), now)
+
+	// everything new is due straight away
+	expected := []AvailabilityRequest{
+		{Provider: ProviderRecreationGov, CampgroundID: "far", TargetTime: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{Provider: ProviderRecreationGov, CampgroundID: "near", TargetTime: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if diff := cmp.Diff(expected, scheduler.Due(now)); diff != "" {
+		t.Fatalf("Due requests mismatch (-want +got):\n%s", diff)
+	}
+
+	var results []AvailabilityResult
+	for _, request := range expected {
+		results = append(results, AvailabilityResult{Request: request})
+	}
+	scheduler.Record(results, now)
+
+	near := scheduler.entries[requestKey(expected[1])]
+	far := scheduler.entries[requestKey(expected[0])]
+	if near.Schniffs != 2 {
+		t.Errorf("Expected 2 schniffs sharing the near request, got %d", near.Schniffs)
+	}
+	if near.Interval != config.MinInterval {
+		t.Errorf("Expected near request to be polled every %s, got %s", config.MinInterval, near.Interval)
+	}
+	if far.Interval <= near.Interval*10 {
+		t.Errorf("Expected far request to be polled much less often than %s, got %s", near.Interval, far.Interval)
+	}
+
+	// only the near request comes around again on the next cycle
+	later := now.Add(config.MinInterval)
+	scheduler.Refresh(sc, NewTracker(), later)
+	if diff := cmp.Diff(expected[1:], scheduler.Due(later)); diff != "" {
+		t.Errorf("Due requests mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSchedulerInterval(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	scheduler := NewScheduler(SchedulerConfig{MinInterval: 15 * time.Second, MaxInterval: 30 * time.Minute})
+
+	for daysAway, expected := range map[int]time.Duration{
+		0:  15 * time.Second,
+		6:  15 * time.Second,
+		7:  15 * time.Second,
+		14: 30 * time.Second,
+		28: time.Minute,
+	} {
+		entry := &scheduleEntry{Schniffs: 1, Nearest: now.AddDate(0, 0, daysAway)}
+		if interval := scheduler.interval(entry, now); interval != expected {
+			t.Errorf("Expected a date %d days away to be polled every %s, got %s", daysAway, expected, interval)
+		}
+	}
+}
+
+func TestSchedulerBudget(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	config := SchedulerConfig{
+		MinInterval:     15 * time.Second,
+		MaxInterval:     30 * time.Minute,
+		RequestsPerHour: 1000,
+	}
+
+	var schniffs []*Schniff
+	for _, campgroundID := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		schniffs = append(schniffs, &Schniff{SchniffID: campgroundID, CampgroundID: campgroundID, StartDate: now, EndDate: now.AddDate(0, 0, 2), Active: true})
+	}
+	sc := newTestSchniffCollection(t, schniffs...)
+
+	scheduler := NewScheduler(config)
+	scheduler.Refresh(sc, NewTracker(), now)
+
+	// 8 requests every 15 seconds would be 1920 an hour
+	var perHour float64
+	for _, entry := range scheduler.entries {
+		perHour += float64(time.Hour) / float64(entry.Interval)
+	}
+	if perHour > float64(config.RequestsPerHour)+0.01 {
+		t.Errorf("Expected at most %d requests an hour, got %.2f", config.RequestsPerHour, perHour)
+	}
+}
+
+func TestSchedulerCancellations(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	config := SchedulerConfig{
+		MinInterval:        15 * time.Second,
+		MaxInterval:        30 * time.Minute,
+		CancellationWindow: time.Hour,
+	}
+
+	sc := newTestSchniffCollection(t,
+		&Schniff{SchniffID: "schniff1", CampgroundID: "camp1", StartDate: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2023, 8, 3, 0, 0, 0, 0, time.UTC), Active: true},
+	)
+	request := AvailabilityRequest{Provider: ProviderRecreationGov, CampgroundID: "camp1", TargetTime: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)}
+
+	availability := func(state string) AvailabilityWithID {
+		return AvailabilityWithID{CampgroundID: "camp1", Availability: Availability{Campsites: map[string]Campsite{
+			"site1": {CampsiteID: "site1", Availabilities: map[string]string{"2023-08-01T00:00:00Z": state}},
+		}}}
+	}
+
+	scheduler := NewScheduler(config)
+	scheduler.Refresh(sc, NewTracker(), now)
+	scheduler.Record([]AvailabilityResult{{Request: request, Availability: availability("Reserved")}}, now)
+	before := scheduler.entries[requestKey(request)].Interval
+
+	now = now.Add(time.Minute)
+	scheduler.Record([]AvailabilityResult{{Request: request, Availability: availability("Available")}}, now)
+	scheduler.RecordTransitions([]Transition{
+		{Provider: ProviderRecreationGov, CampgroundID: "camp1", CampsiteID: "site1", Date: request.TargetTime, From: StateReserved, To: StateAvailable, At: now},
+		// releases aren't cancellations
+		{Provider: ProviderRecreationGov, CampgroundID: "camp1", CampsiteID: "site1", Date: request.TargetTime, From: StateNotYetReleased, To: StateAvailable, At: now},
+	})
+	if got := len(scheduler.cancellations[campgroundKey(ProviderRecreationGov, "camp1")]); got != 1 {
+		t.Errorf("Expected 1 cancellation, got %d", got)
+	}
+	scheduler.Refresh(sc, NewTracker(), now)
+	after := scheduler.entries[requestKey(request)].Interval
+	if after >= before {
+		t.Errorf("Expected a cancellation to shorten the interval from %s, got %s", before, after)
+	}
+
+	// failures still push the next poll back but don't replace what we last saw
+	scheduler.Record([]AvailabilityResult{{Request: request, Err: errors.New("boom")}}, now)
+	if diff := cmp.Diff([]AvailabilityWithID{availability("Available")}, scheduler.Availabilities([]AvailabilityResult{{Request: request}})); diff != "" {
+		t.Errorf("Availabilities mismatch (-want +got):\n%s", diff)
+	}
+	if due := scheduler.Due(now); len(due) != 0 {
+		t.Errorf("Expected nothing due straight after a poll, got %v", due)
+	}
+
+	// once the cancellation is out of the window it stops counting
+	now = now.Add(2 * time.Hour)
+	scheduler.Refresh(sc, NewTracker(), now)
+	if got := scheduler.entries[requestKey(request)].Interval; got <= after {
+		t.Errorf("Expected interval to back off from %s once the cancellation expired, got %s", after, got)
+	}
+}
@@ -1,10 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +12,8 @@ import (
 
 const (
 	SchniffDir = "schniffs"
+	// maxEmbedFields is the most fields discord allows in an embed
+	maxEmbedFields = 25
 )
 
 type Schniff struct {
@@ -21,6 +21,7 @@ type Schniff struct {
 	Active       bool      `json:"active"`
 	CreationTime time.Time `json:"creation_time"`
 
+	Provider               string    `json:"provider,omitempty"`
 	CampgroundID           string    `json:"campground_id"`
 	CampgroundName         string    `json:"campground_name"`
 	CampsiteIDs            []string  `json:"campsite_ids"`
@@ -29,49 +30,159 @@ type Schniff struct {
 	UserID                 string    `json:"user_id"`
 	UserNick               string    `json:"user_nick"`
 	MinimumConsecutiveDays int64     `json:"minimum_consecutive_days"`
+	// CheckInDays are the days a stay can start on, empty for any day
+	CheckInDays []time.Weekday `json:"check_in_days,omitempty"`
+	// CheckInNights is the shortest stay the check-in preset needs, eg 2 for fri+sat nights. It's kept apart
+	// from MinimumConsecutiveDays so the minimum goes back to what it was when the preset is removed.
+	CheckInNights int64 `json:"check_in_nights,omitempty"`
+	// StayLength makes the schniff flexible, looking for any stay of exactly this many nights between
+	// StartDate and EndDate. Zero looks for runs of at least MinimumConsecutiveDays instead.
+	StayLength int64 `json:"stay_length,omitempty"`
+	// PartySize leaves out campsites that are too big or too small for the group, zero for any campsite
+	PartySize int64 `json:"party_size,omitempty"`
+	// IncludeTypes and ExcludeTypes pick campsites by their CampsiteType, eg STANDARD NONELECTRIC. An empty
+	// IncludeTypes allows every type that isn't excluded.
+	IncludeTypes []string `json:"include_types,omitempty"`
+	ExcludeTypes []string `json:"exclude_types,omitempty"`
+	// TypeOfUse only allows campsites for this use, eg Overnight, or any use if empty
+	TypeOfUse string `json:"type_of_use,omitempty"`
+	// Loops only allows campsites in these loops of the campground, or every loop if empty
+	Loops []string `json:"loops,omitempty"`
+	// VehicleLength only allows campsites that fit a vehicle this long in feet, zero for any campsite.
+	// AccessibleOnly and WithPets only allow accessible campsites and campsites that allow pets. These come from
+	// the CampsiteCatalog, so campsites we don't have details for never match them.
+	VehicleLength  int64 `json:"vehicle_length,omitempty"`
+	AccessibleOnly bool  `json:"accessible_only,omitempty"`
+	WithPets       bool  `json:"with_pets,omitempty"`
+	// Email opts the owner in to email notifications at this address as well as discord, off if empty
+	Email string `json:"email,omitempty"`
+	// UpdatedTime is when the schniff was last edited, zero if it never has been
+	UpdatedTime time.Time `json:"updated_time"`
+	// LastNotified is when the owner was last told about something, zero if they never have been
+	LastNotified time.Time `json:"last_notified"`
+	// Expired is set once every night the schniff wants has gone
+	Expired bool `json:"expired"`
 }
 
-type SchniffCollection struct {
-	schniffs     []*Schniff
-	mutex        sync.Mutex
-	fileLocation string
+// ProviderName is the provider the schniff's campground is on. Schniffs made before there were providers
+// don't have one and are all on the default provider.
+func (s *Schniff) ProviderName() string {
+	return providerOrDefault(s.Provider)
 }
 
-func NewSchniffCollection(fileLocation string) *SchniffCollection {
+// MinimumNights is the shortest run of nights the schniff is after, which is at least one night and long
+// enough for the check-in preset
+func (s *Schniff) MinimumNights() int {
+	minimumNights := s.MinimumConsecutiveDays
+	if s.CheckInNights > minimumNights {
+		minimumNights = s.CheckInNights
+	}
+	if minimumNights < 1 {
+		minimumNights = 1
+	}
+	return int(minimumNights)
+}
 
-	location := filepath.Join(SchniffDir, fileLocation)
-	sc := &SchniffCollection{
-		schniffs:     make([]*Schniff, 0),
-		mutex:        sync.Mutex{},
-		fileLocation: location,
+// Wants is whether the campsite is the kind of campsite the schniff is after
+func (s *Schniff) Wants(campsite Campsite) bool {
+	if !campsite.Fits(int(s.PartySize)) {
+		return false
+	}
+	if len(s.IncludeTypes) > 0 && !containsFold(s.IncludeTypes, campsite.CampsiteType) {
+		return false
+	}
+	if containsFold(s.ExcludeTypes, campsite.CampsiteType) {
+		return false
+	}
+	if s.TypeOfUse != "" && !strings.EqualFold(s.TypeOfUse, campsite.TypeOfUse) {
+		return false
 	}
+	if len(s.Loops) > 0 && !containsFold(s.Loops, campsite.Loop) {
+		return false
+	}
+	return s.wantsDetails(campsite.Details)
+}
 
-	// Check if file exists
-	if _, err := os.Stat(location); os.IsNotExist(err) {
-		// Create the file if it does not exist
-		err := os.Mkdir(SchniffDir, 0755)
-		if err != nil {
-			panic(err)
-		}
+// FiltersOnDetails is whether the schniff needs campsite details from the CampsiteCatalog to match anything
+func (s *Schniff) FiltersOnDetails() bool {
+	return s.VehicleLength > 0 || s.AccessibleOnly || s.WithPets
+}
 
-		_, err = os.Create(location)
-		if err != nil {
-			panic(err)
+// wantsDetails is whether the campsite details are good enough for the schniff
+func (s *Schniff) wantsDetails(details *CampsiteDetails) bool {
+	if !s.FiltersOnDetails() {
+		return true
+	}
+	if details == nil {
+		return false
+	}
+	if details.MaxVehicleLength < int(s.VehicleLength) {
+		return false
+	}
+	if s.AccessibleOnly && !details.Accessible {
+		return false
+	}
+	if s.WithPets && !details.PetsAllowed {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
 		}
 	}
+	return false
+}
 
-	sc.load()
+// Over is whether the last night the schniff wants is before today
+func (s *Schniff) Over(today time.Time) bool {
+	return s.EndDate.Before(today)
+}
 
-	return sc
+type SchniffCollection struct {
+	schniffs []*Schniff
+	mutex    sync.Mutex
+	store    SchniffStore
+	// archive is where schniffs go once they've expired. Without one they stay in the collection.
+	archive SchniffStore
+}
+
+// NewSchniffCollection loads all the schniffs from the store. ArchiveExpired moves expired schniffs into
+// archive, which can be nil to keep them in the store.
+func NewSchniffCollection(store SchniffStore, archive SchniffStore) (*SchniffCollection, error) {
+	schniffs, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if schniffs == nil {
+		schniffs = make([]*Schniff, 0)
+	}
+
+	return &SchniffCollection{
+		schniffs: schniffs,
+		mutex:    sync.Mutex{},
+		store:    store,
+		archive:  archive,
+	}, nil
 }
 
 func (sc *SchniffCollection) Add(s *Schniff) error {
 	sc.mutex.Lock()
 	defer sc.mutex.Unlock()
 
+	// only keep it in memory once it's safely stored
+	err := sc.store.Put(s)
+	if err != nil {
+		return err
+	}
+
 	sc.schniffs = append(sc.schniffs, s)
 
-	return sc.save()
+	return nil
 }
 
 func (sc *SchniffCollection) SetActive(id string, active bool) error {
@@ -82,68 +193,272 @@ func (sc *SchniffCollection) SetActive(id string, active bool) error {
 		if schniff.SchniffID != id {
 			continue
 		}
+
+		updated := *schniff
+		updated.Active = active
+		err := sc.store.Put(&updated)
+		if err != nil {
+			return err
+		}
+
 		schniff.Active = active
-		return sc.save()
+		return nil
 	}
 
 	return fmt.Errorf("id not found")
 }
 
-func (sc *SchniffCollection) GetSchniff(id string) (*Schniff, error) {
+// Update replaces the schniff with the same SchniffID. Anyone already holding the schniff sees the change.
+func (sc *SchniffCollection) Update(s *Schniff) error {
 	sc.mutex.Lock()
 	defer sc.mutex.Unlock()
 
 	for _, schniff := range sc.schniffs {
+		if schniff.SchniffID != s.SchniffID {
+			continue
+		}
+
+		err := sc.store.Put(s)
+		if err != nil {
+			return err
+		}
+
+		*schniff = *s
+		return nil
+	}
+
+	return fmt.Errorf("id not found")
+}
+
+// Delete removes the schniff for good, including from the archive
+func (sc *SchniffCollection) Delete(id string) error {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	for i, schniff := range sc.schniffs {
 		if schniff.SchniffID != id {
 			continue
 		}
-		return schniff, nil
+
+		err := sc.store.Delete(id)
+		if err != nil {
+			return err
+		}
+
+		sc.schniffs = append(sc.schniffs[:i], sc.schniffs[i+1:]...)
+		break
 	}
 
-	return nil, fmt.Errorf("id not found")
+	if sc.archive == nil {
+		return nil
+	}
+	return sc.archive.Delete(id)
 }
 
-func (sc *SchniffCollection) GetSchniffsForUser(userID string) []*Schniff {
+// Roll brings the schniffs up to date with the calendar. Nights before today are dropped from the start of
+// each schniff, and schniffs with no nights left are stopped and marked expired. It returns the schniffs that
+// were still running when they expired.
+func (sc *SchniffCollection) Roll(today time.Time) ([]*Schniff, error) {
 	sc.mutex.Lock()
 	defer sc.mutex.Unlock()
 
-	var schniffsForUser []*Schniff
+	var changed, expired []*Schniff
 	for _, schniff := range sc.schniffs {
-		if schniff.UserID == userID {
+		if schniff.Expired {
+			continue
+		}
 
-			schniffsForUser = append(schniffsForUser, schniff)
+		updated := *schniff
+		switch {
+		case schniff.Over(today):
+			updated.Active = false
+			updated.Expired = true
+			if schniff.Active {
+				expired = append(expired, schniff)
+			}
+		case schniff.StartDate.Before(today):
+			updated.StartDate = today
+		default:
+			continue
 		}
+		changed = append(changed, &updated)
+	}
+	if len(changed) == 0 {
+		return nil, nil
 	}
 
-	return schniffsForUser
+	err := sc.store.Put(changed...)
+	if err != nil {
+		return nil, err
+	}
+
+	// changed is in the same order as the schniffs it came from
+	for _, schniff := range sc.schniffs {
+		if len(changed) == 0 {
+			break
+		}
+		if schniff.SchniffID == changed[0].SchniffID {
+			*schniff = *changed[0]
+			changed = changed[1:]
+		}
+	}
+
+	return expired, nil
 }
 
-func (sc *SchniffCollection) load() error {
+// MarkNotified stores that the owner of the schniff was just told about something
+func (sc *SchniffCollection) MarkNotified(id string, now time.Time) error {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	for _, schniff := range sc.schniffs {
+		if schniff.SchniffID != id {
+			continue
+		}
+
+		updated := *schniff
+		updated.LastNotified = now
+		err := sc.store.Put(&updated)
+		if err != nil {
+			return err
+		}
+
+		schniff.LastNotified = now
+		return nil
+	}
+
+	return fmt.Errorf("id not found")
+}
+
+// ArchiveExpired moves every expired schniff into the archive, and returns the schniffs that moved
+func (sc *SchniffCollection) ArchiveExpired() ([]*Schniff, error) {
+	if sc.archive == nil {
+		return nil, nil
+	}
+
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	var expired, kept []*Schniff
+	var ids []string
+	for _, schniff := range sc.schniffs {
+		if !schniff.Expired {
+			kept = append(kept, schniff)
+			continue
+		}
+		expired = append(expired, schniff)
+		ids = append(ids, schniff.SchniffID)
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
 
-	data, err := os.ReadFile(sc.fileLocation)
+	// archive first so a failure part way through leaves the schniff in both stores rather than neither.
+	// archiving it again next time just replaces the copy.
+	err := sc.archive.Put(expired...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	err = sc.store.Delete(ids...)
+	if err != nil {
+		return nil, err
 	}
 
-	err = json.Unmarshal(data, &sc.schniffs)
+	if kept == nil {
+		kept = make([]*Schniff, 0)
+	}
+	sc.schniffs = kept
+	return expired, nil
+}
+
+// GetArchivedSchniffsForUser gets the user's schniffs that are over, most recent first
+func (sc *SchniffCollection) GetArchivedSchniffsForUser(userID string) ([]*Schniff, error) {
+	if sc.archive == nil {
+		return nil, nil
+	}
+
+	archived, err := sc.archive.Load()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	var schniffsForUser []*Schniff
+	for _, schniff := range archived {
+		if schniff.UserID == userID {
+			schniffsForUser = append(schniffsForUser, schniff)
+		}
+	}
+	sort.SliceStable(schniffsForUser, func(i, j int) bool {
+		return schniffsForUser[i].EndDate.After(schniffsForUser[j].EndDate)
+	})
+
+	return schniffsForUser, nil
 }
 
-func (sc *SchniffCollection) save() error {
+// GetArchivedSchniff gets a schniff that's over from the archive
+func (sc *SchniffCollection) GetArchivedSchniff(id string) (*Schniff, error) {
+	if sc.archive == nil {
+		return nil, fmt.Errorf("id not found")
+	}
 
-	data, err := json.MarshalIndent(sc.schniffs, "", "  ")
+	archived, err := sc.archive.Load()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for _, schniff := range archived {
+		if schniff.SchniffID == id {
+			return schniff, nil
+		}
 	}
 
-	return os.WriteFile(sc.fileLocation, data, 0644)
+	return nil, fmt.Errorf("id not found")
 }
 
-func GenerateEmbedMessage(schniffs []*Schniff) *discordgo.MessageEmbed {
+func (sc *SchniffCollection) GetSchniff(id string) (*Schniff, error) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	for _, schniff := range sc.schniffs {
+		if schniff.SchniffID != id {
+			continue
+		}
+		return schniff, nil
+	}
+
+	return nil, fmt.Errorf("id not found")
+}
+
+func (sc *SchniffCollection) GetSchniffsForUser(userID string) []*Schniff {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	var schniffsForUser []*Schniff
+	for _, schniff := range sc.schniffs {
+		if schniff.UserID == userID {
+
+			schniffsForUser = append(schniffsForUser, schniff)
+		}
+	}
+
+	return schniffsForUser
+}
+
+// ActiveSchniffIDs returns the set of IDs of every schniff that is currently active
+func (sc *SchniffCollection) ActiveSchniffIDs() map[string]struct{} {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	active := make(map[string]struct{})
+	for _, schniff := range sc.schniffs {
+		if schniff.Active {
+			active[schniff.SchniffID] = struct{}{}
+		}
+	}
+
+	return active
+}
+
+func GenerateEmbedMessage(providers ProviderRegistry, schniffs []*Schniff) *discordgo.MessageEmbed {
 	embed := &discordgo.MessageEmbed{
 		Title:  "Campground Details",
 		Color:  0x00ff00, // Green color
@@ -151,7 +466,11 @@ func GenerateEmbedMessage(schniffs []*Schniff) *discordgo.MessageEmbed {
 	}
 
 	for _, schniff := range schniffs {
-		campgroundURL := fmt.Sprintf("https://www.recreation.gov/camping/campgrounds/%s", schniff.CampgroundID)
+		campgroundURL := ""
+		provider, err := providers.Get(schniff.Provider)
+		if err == nil {
+			campgroundURL = provider.CampgroundURL(schniff.CampgroundID)
+		}
 
 		fieldName := schniff.CampgroundName
 		fieldValue := fmt.Sprintf(
@@ -163,6 +482,33 @@ func GenerateEmbedMessage(schniffs []*Schniff) *discordgo.MessageEmbed {
 			strings.Join(schniff.CampsiteIDs, ","),
 			schniff.Active,
 		)
+		if len(schniff.CheckInDays) > 0 {
+			fieldValue += fmt.Sprintf("\nCheckInDays: %s", checkInDaysString(schniff.CheckInDays))
+		}
+		if schniff.StayLength > 0 {
+			fieldValue += fmt.Sprintf("\nStayLength: %s", stayLengthString(schniff.StayLength))
+		}
+		if schniff.PartySize > 0 {
+			fieldValue += fmt.Sprintf("\nPartySize: %d", schniff.PartySize)
+		}
+		if len(schniff.IncludeTypes) > 0 {
+			fieldValue += fmt.Sprintf("\nIncludeTypes: %s", strings.Join(schniff.IncludeTypes, ","))
+		}
+		if len(schniff.ExcludeTypes) > 0 {
+			fieldValue += fmt.Sprintf("\nExcludeTypes: %s", strings.Join(schniff.ExcludeTypes, ","))
+		}
+		if schniff.TypeOfUse != "" {
+			fieldValue += fmt.Sprintf("\nTypeOfUse: %s", schniff.TypeOfUse)
+		}
+		if len(schniff.Loops) > 0 {
+			fieldValue += fmt.Sprintf("\nLoops: %s", strings.Join(schniff.Loops, ","))
+		}
+		if details := detailFiltersString(schniff); details != "Any" {
+			fieldValue += fmt.Sprintf("\nCampsiteDetails: %s", details)
+		}
+		if schniff.Email != "" {
+			fieldValue += fmt.Sprintf("\nEmail: %s", MaskEmail(schniff.Email))
+		}
 
 		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
 			Name:   fieldName,
@@ -173,3 +519,93 @@ func GenerateEmbedMessage(schniffs []*Schniff) *discordgo.MessageEmbed {
 
 	return embed
 }
+
+// GenerateEditEmbed shows what an edit changed about a schniff
+func GenerateEditEmbed(before, after *Schniff) *discordgo.MessageEmbed {
+	campsites := func(schniff *Schniff) string {
+		if len(schniff.CampsiteIDs) == 0 {
+			return "All"
+		}
+		return strings.Join(schniff.CampsiteIDs, ", ")
+	}
+
+	rows := []struct {
+		name          string
+		before, after string
+	}{
+		{"Start Date", before.StartDate.Format("2006-01-02"), after.StartDate.Format("2006-01-02")},
+		{"End Date", before.EndDate.Format("2006-01-02"), after.EndDate.Format("2006-01-02")},
+		{"Campsite IDs", campsites(before), campsites(after)},
+		{"Minimum Consecutive Days", fmt.Sprintf("%d", before.MinimumConsecutiveDays), fmt.Sprintf("%d", after.MinimumConsecutiveDays)},
+		{"Check-in Days", checkInDaysString(before.CheckInDays), checkInDaysString(after.CheckInDays)},
+		{"Stay Length", stayLengthString(before.StayLength), stayLengthString(after.StayLength)},
+		{"Party Size", partySizeString(before.PartySize), partySizeString(after.PartySize)},
+		{"Include Types", listString(before.IncludeTypes, "All"), listString(after.IncludeTypes, "All")},
+		{"Exclude Types", listString(before.ExcludeTypes, "None"), listString(after.ExcludeTypes, "None")},
+		{"Use Type", listString([]string{before.TypeOfUse}, "Any"), listString([]string{after.TypeOfUse}, "Any")},
+		{"Loops", listString(before.Loops, "All"), listString(after.Loops, "All")},
+		{"Campsite Details", detailFiltersString(before), detailFiltersString(after)},
+		{"Email", listString([]string{MaskEmail(before.Email)}, "Off"), listString([]string{MaskEmail(after.Email)}, "Off")},
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Schniff Updated",
+		Description: fmt.Sprintf("%s (%s)", after.CampgroundName, after.SchniffID),
+		Color:       0x009900, // Green color
+	}
+	for _, row := range rows {
+		value := row.after
+		if row.before != row.after {
+			value = fmt.Sprintf("~~%s~~ → %s", row.before, row.after)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   row.name,
+			Value:  value,
+			Inline: row.name != "Campsite IDs",
+		})
+	}
+
+	return embed
+}
+
+// stayLengthString describes the stay a flexible schniff is after
+func stayLengthString(stayLength int64) string {
+	if stayLength == 0 {
+		return "Not flexible"
+	}
+	return fmt.Sprintf("Any %s", nightsString(int(stayLength)))
+}
+
+func partySizeString(partySize int64) string {
+	if partySize == 0 {
+		return "Any"
+	}
+	return fmt.Sprintf("%d", partySize)
+}
+
+// detailFiltersString describes what the schniff needs from the campsite details, eg RV up to 30ft, Accessible
+func detailFiltersString(schniff *Schniff) string {
+	filters := CampsiteDetails{
+		MaxVehicleLength: int(schniff.VehicleLength),
+		Accessible:       schniff.AccessibleOnly,
+		PetsAllowed:      schniff.WithPets,
+	}.String()
+	if filters == "" {
+		return "Any"
+	}
+	return filters
+}
+
+// listString joins the values for people to read, or gives empty if there aren't any
+func listString(values []string, empty string) string {
+	var nonEmpty []string
+	for _, value := range values {
+		if value != "" {
+			nonEmpty = append(nonEmpty, value)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return empty
+	}
+	return strings.Join(nonEmpty, ", ")
+}
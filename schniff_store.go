@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	SchniffStoreJSON = "json"
+	SchniffStoreBolt = "bolt"
+)
+
+// SchniffStore is where a SchniffCollection persists its schniffs. Every write is applied as a single
+// transaction, so either all of the schniffs passed in are stored or none of them are.
+type SchniffStore interface {
+	// Load returns every schniff in the store
+	Load() ([]*Schniff, error)
+	// Put creates or replaces the schniffs, keyed by SchniffID
+	Put(schniffs ...*Schniff) error
+	// Delete removes the schniffs with these IDs. IDs that aren't in the store are ignored.
+	Delete(ids ...string) error
+	Close() error
+}
+
+// JSONSchniffStore keeps all schniffs in a single json file
+type JSONSchniffStore struct {
+	mu           sync.Mutex
+	fileLocation string
+}
+
+func NewJSONSchniffStore(fileLocation string) *JSONSchniffStore {
+	return &JSONSchniffStore{
+		fileLocation: fileLocation,
+	}
+}
+
+func (js *JSONSchniffStore) Load() ([]*Schniff, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	return js.load()
+}
+
+func (js *JSONSchniffStore) Put(schniffs ...*Schniff) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	existing, err := js.load()
+	if err != nil {
+		return err
+	}
+
+	for _, schniff := range schniffs {
+		replaced := false
+		for i, existingSchniff := range existing {
+			if existingSchniff.SchniffID == schniff.SchniffID {
+				existing[i] = schniff
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			existing = append(existing, schniff)
+		}
+	}
+
+	return js.save(existing)
+}
+
+func (js *JSONSchniffStore) Delete(ids ...string) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	existing, err := js.load()
+	if err != nil {
+		return err
+	}
+
+	deleted := make(map[string]struct{})
+	for _, id := range ids {
+		deleted[id] = struct{}{}
+	}
+
+	var kept []*Schniff
+	for _, schniff := range existing {
+		if _, ok := deleted[schniff.SchniffID]; ok {
+			continue
+		}
+		kept = append(kept, schniff)
+	}
+	if len(kept) == len(existing) {
+		return nil
+	}
+
+	return js.save(kept)
+}
+
+func (js *JSONSchniffStore) Close() error {
+	return nil
+}
+
+// Exists reports whether the json file has been created yet
+func (js *JSONSchniffStore) Exists() bool {
+	_, err := os.Stat(js.fileLocation)
+	return err == nil
+}
+
+func (js *JSONSchniffStore) load() ([]*Schniff, error) {
+	data, err := os.ReadFile(js.fileLocation)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// older versions created an empty file before the first schniff was added
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var schniffs []*Schniff
+	err = json.Unmarshal(data, &schniffs)
+	if err != nil {
+		return nil, err
+	}
+
+	return schniffs, nil
+}
+
+func (js *JSONSchniffStore) save(schniffs []*Schniff) error {
+	data, err := json.MarshalIndent(schniffs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(js.fileLocation), 0755)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file and swap it in so a failed write never leaves a half written file behind
+	tmpLocation := js.fileLocation + ".tmp"
+	err = os.WriteFile(tmpLocation, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpLocation, js.fileLocation)
+}
+
+var schniffBucket = []byte("schniffs")
+
+// BoltSchniffStore keeps each schniff as its own key in a bbolt database
+type BoltSchniffStore struct {
+	db *bolt.DB
+}
+
+func NewBoltSchniffStore(fileLocation string) (*BoltSchniffStore, error) {
+	err := os.MkdirAll(filepath.Dir(fileLocation), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(fileLocation, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(schniffBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltSchniffStore{db: db}, nil
+}
+
+func (bs *BoltSchniffStore) Load() ([]*Schniff, error) {
+	var schniffs []*Schniff
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(schniffBucket).ForEach(func(k, v []byte) error {
+			var schniff Schniff
+			err := json.Unmarshal(v, &schniff)
+			if err != nil {
+				return fmt.Errorf("couldn't unmarshal schniff %s: %w", k, err)
+			}
+			schniffs = append(schniffs, &schniff)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// keys are uuids so put them back in the order they were made
+	sort.SliceStable(schniffs, func(i, j int) bool {
+		return schniffs[i].CreationTime.Before(schniffs[j].CreationTime)
+	})
+
+	return schniffs, nil
+}
+
+func (bs *BoltSchniffStore) Put(schniffs ...*Schniff) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schniffBucket)
+		for _, schniff := range schniffs {
+			data, err := json.Marshal(schniff)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put([]byte(schniff.SchniffID), data)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *BoltSchniffStore) Delete(ids ...string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schniffBucket)
+		for _, id := range ids {
+			err := bucket.Delete([]byte(id))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *BoltSchniffStore) Close() error {
+	return bs.db.Close()
+}
+
+// OpenSchniffStore opens the store chosen in the config. When the bolt store is chosen and the json file
+// from before still exists, its schniffs are copied across once and the file is renamed so it isn't
+// migrated again.
+func OpenSchniffStore(config Config) (SchniffStore, error) {
+	jsonStore := NewJSONSchniffStore(config.SchniffJSONFile)
+
+	switch config.SchniffStore {
+	case SchniffStoreJSON:
+		return jsonStore, nil
+	case SchniffStoreBolt:
+		boltStore, err := NewBoltSchniffStore(config.SchniffBoltFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if !jsonStore.Exists() {
+			return boltStore, nil
+		}
+
+		_, err = MigrateSchniffs(jsonStore, boltStore)
+		if err != nil {
+			boltStore.Close()
+			return nil, fmt.Errorf("couldn't migrate schniffs from %s: %w", config.SchniffJSONFile, err)
+		}
+
+		err = os.Rename(config.SchniffJSONFile, config.SchniffJSONFile+".migrated")
+		if err != nil {
+			boltStore.Close()
+			return nil, err
+		}
+
+		return boltStore, nil
+	}
+
+	return nil, fmt.Errorf("unknown schniff store: %s", config.SchniffStore)
+}
+
+// OpenSchniffArchive opens the store that schniffs are moved to once they're over. It uses the same backend as
+// the live store.
+func OpenSchniffArchive(config Config) (SchniffStore, error) {
+	switch config.SchniffStore {
+	case SchniffStoreJSON:
+		return NewJSONSchniffStore(config.SchniffArchiveJSONFile), nil
+	case SchniffStoreBolt:
+		boltStore, err := NewBoltSchniffStore(config.SchniffArchiveBoltFile)
+		if err != nil {
+			return nil, err
+		}
+		return boltStore, nil
+	}
+
+	return nil, fmt.Errorf("unknown schniff store: %s", config.SchniffStore)
+}
+
+// MigrateSchniffs copies every schniff from one store to another in a single transaction. It refuses to
+// copy into a store that already has schniffs in it.
+func MigrateSchniffs(from, to SchniffStore) (int, error) {
+	existing, err := to.Load()
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) > 0 {
+		return 0, fmt.Errorf("destination already has %d schniffs", len(existing))
+	}
+
+	schniffs, err := from.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	err = to.Put(schniffs...)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(schniffs), nil
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -10,58 +10,133 @@ import (
 )
 
 func TestSchniffCollection(t *testing.T) {
-	// Arrange
-	tempFile, err := os.CreateTemp("", "schniffs")
-	if err != nil {
-		t.Fatalf("Failed to create temp file: %v", err)
+	stores := map[string]func(t *testing.T) SchniffStore{
+		SchniffStoreJSON: func(t *testing.T) SchniffStore {
+			return NewJSONSchniffStore(filepath.Join(t.TempDir(), "schniffs.json"))
+		},
+		SchniffStoreBolt: func(t *testing.T) SchniffStore {
+			store, err := NewBoltSchniffStore(filepath.Join(t.TempDir(), "schniffs.db"))
+			if err != nil {
+				t.Fatalf("Failed to open bolt store: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
 	}
-	defer os.Remove(tempFile.Name())
 
-	expectedSchniff := &Schniff{
-		CampgroundID: "camp1",
-		CampsiteIDs:  []string{"site1", "site2"},
-		StartDate:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
-		UserID:       "user1",
-	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			store := newStore(t)
 
-	// Act
-	sc := NewSchniffCollection(tempFile.Name())
-	err = sc.Add(expectedSchniff)
-	if err != nil {
-		t.Fatalf("Failed to add schniff: %v", err)
+			expectedSchniff := &Schniff{
+				SchniffID:    "schniff1",
+				CampgroundID: "camp1",
+				CampsiteIDs:  []string{"site1", "site2"},
+				StartDate:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+				EndDate:      time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+				UserID:       "user1",
+			}
+
+			// Act
+			sc, err := NewSchniffCollection(store, nil)
+			if err != nil {
+				t.Fatalf("Failed to create schniff collection: %v", err)
+			}
+			err = sc.Add(expectedSchniff)
+			if err != nil {
+				t.Fatalf("Failed to add schniff: %v", err)
+			}
+
+			// Assert
+			// Verify the schniff was added correctly
+			if len(sc.schniffs) != 1 {
+				t.Errorf("Expected 1 schniff, got %d", len(sc.schniffs))
+			}
+
+			if diff := cmp.Diff(expectedSchniff, sc.schniffs[0]); diff != "" {
+				t.Errorf("Schniff mismatch (-want +got):\n%s", diff)
+			}
+
+			// Act
+			// Change the schniff and load it back from the store
+			err = sc.SetActive(expectedSchniff.SchniffID, true)
+			if err != nil {
+				t.Fatalf("Failed to set schniff active: %v", err)
+			}
+
+			sc, err = NewSchniffCollection(store, nil)
+			if err != nil {
+				t.Fatalf("Failed to load schniffs: %v", err)
+			}
+
+			// Assert
+			// Verify the schniff was loaded correctly
+			if len(sc.schniffs) != 1 {
+				t.Fatalf("Expected 1 schniff, got %d", len(sc.schniffs))
+			}
+
+			if diff := cmp.Diff(expectedSchniff, sc.schniffs[0]); diff != "" {
+				t.Errorf("Schniff mismatch (-want +got):\n%s", diff)
+			}
+
+			err = sc.SetActive("not a schniff", true)
+			if err == nil {
+				t.Errorf("Expected error setting unknown schniff active")
+			}
+		})
 	}
+}
 
-	// Assert
-	// Verify the schniff was added correctly
-	if len(sc.schniffs) != 1 {
-		t.Errorf("Expected 1 schniff, got %d", len(sc.schniffs))
+func TestOpenSchniffStoreMigratesJSON(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{
+		SchniffStore:    SchniffStoreBolt,
+		SchniffJSONFile: filepath.Join(dir, "schniffs.json"),
+		SchniffBoltFile: filepath.Join(dir, "schniffs.db"),
 	}
 
-	if diff := cmp.Diff(expectedSchniff, sc.schniffs[0]); diff != "" {
-		t.Errorf("Schniff mismatch (-want +got):\n%s", diff)
+	jsonStore := NewJSONSchniffStore(config.SchniffJSONFile)
+	schniffs := []*Schniff{
+		{SchniffID: "first", CampgroundID: "camp1", CreationTime: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{SchniffID: "second", CampgroundID: "camp2", CreationTime: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	err := jsonStore.Put(schniffs...)
+	if err != nil {
+		t.Fatalf("Failed to write json schniffs: %v", err)
 	}
 
-	// Act
-	// Save and load the schniffs
-	err = sc.save()
+	store, err := OpenSchniffStore(config)
 	if err != nil {
-		t.Fatalf("Failed to save schniffs: %v", err)
+		t.Fatalf("Failed to open store: %v", err)
 	}
 
-	err = sc.load()
+	migrated, err := store.Load()
 	if err != nil {
-		t.Fatalf("Failed to load schniffs: %v", err)
+		t.Fatalf("Failed to load migrated schniffs: %v", err)
+	}
+	if diff := cmp.Diff(schniffs, migrated); diff != "" {
+		t.Errorf("Migrated schniffs mismatch (-want +got):\n%s", diff)
 	}
 
-	// Assert
-	// Verify the schniff was loaded correctly
-	if len(sc.schniffs) != 1 {
-		t.Errorf("Expected 1 schniff, got %d", len(sc.schniffs))
+	if jsonStore.Exists() {
+		t.Errorf("Expected json file to be moved out of the way after migrating")
 	}
 
-	if diff := cmp.Diff(expectedSchniff, sc.schniffs[0]); diff != "" {
-		t.Errorf("Schniff mismatch (-want +got):\n%s", diff)
+	// opening again shouldn't try to migrate a second time
+	store.Close()
+	store, err = OpenSchniffStore(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	migrated, err = store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load schniffs: %v", err)
+	}
+	if len(migrated) != len(schniffs) {
+		t.Errorf("Expected %d schniffs, got %d", len(schniffs), len(migrated))
 	}
 }
 
@@ -79,7 +154,7 @@ func TestGenerateTableMessage(t *testing.T) {
 		},
 	}
 
-	message := GenerateEmbedMessage(schniffs)
+	message := GenerateEmbedMessage(testProviders(), schniffs)
 
 	fmt.Println(message.Title)
 	fmt.Println(message.Description)
@@ -88,3 +163,184 @@ func TestGenerateTableMessage(t *testing.T) {
 		fmt.Println(field.Value)
 	}
 }
+
+func TestSchniffCollectionUpdate(t *testing.T) {
+	store := NewJSONSchniffStore(filepath.Join(t.TempDir(), "schniffs.json"))
+	sc, err := NewSchniffCollection(store, nil)
+	if err != nil {
+		t.Fatalf("Failed to create schniff collection: %v", err)
+	}
+	original := &Schniff{
+		SchniffID:              "schniff1",
+		CampgroundID:           "camp1",
+		CampgroundName:         "Camp One",
+		CampsiteIDs:            []string{"site1"},
+		StartDate:              time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:                time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		MinimumConsecutiveDays: 1,
+	}
+	err = sc.Add(original)
+	if err != nil {
+		t.Fatalf("Failed to add schniff: %v", err)
+	}
+
+	before := *original
+	updated := *original
+	updated.EndDate = time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC)
+	updated.CampsiteIDs = nil
+	updated.UpdatedTime = time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	err = sc.Update(&updated)
+	if err != nil {
+		t.Fatalf("Failed to update schniff: %v", err)
+	}
+
+	// anyone holding the schniff sees the edit, and it survives a reload
+	if diff := cmp.Diff(&updated, original); diff != "" {
+		t.Errorf("Schniff mismatch (-want +got):\n%s", diff)
+	}
+	sc, err = NewSchniffCollection(store, nil)
+	if err != nil {
+		t.Fatalf("Failed to load schniffs: %v", err)
+	}
+	if diff := cmp.Diff(&updated, sc.schniffs[0]); diff != "" {
+		t.Errorf("Stored schniff mismatch (-want +got):\n%s", diff)
+	}
+
+	err = sc.Update(&Schniff{SchniffID: "not a schniff"})
+	if err == nil {
+		t.Errorf("Expected error updating unknown schniff")
+	}
+
+	embed := GenerateEditEmbed(&before, &updated)
+	got := make(map[string]string)
+	for _, field := range embed.Fields {
+		got[field.Name] = field.Value
+	}
+	expected := map[string]string{
+		"Start Date":               "2023-01-01",
+		"End Date":                 "~~2023-01-02~~ → 2023-01-05",
+		"Campsite IDs":             "~~site1~~ → All",
+		"Minimum Consecutive Days": "1",
+		"Check-in Days":            "Any",
+		"Stay Length":              "Not flexible",
+		"Party Size":               "Any",
+		"Include Types":            "All",
+		"Exclude Types":            "None",
+		"Use Type":                 "Any",
+		"Loops":                    "All",
+		"Campsite Details":         "Any",
+		"Email":                    "Off",
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Embed fields mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSchniffCollectionArchive(t *testing.T) {
+	stores := map[string]func(t *testing.T, name string) SchniffStore{
+		SchniffStoreJSON: func(t *testing.T, name string) SchniffStore {
+			return NewJSONSchniffStore(filepath.Join(t.TempDir(), name+".json"))
+		},
+		SchniffStoreBolt: func(t *testing.T, name string) SchniffStore {
+			store, err := NewBoltSchniffStore(filepath.Join(t.TempDir(), name+".db"))
+			if err != nil {
+				t.Fatalf("Failed to open bolt store: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t, "schniffs")
+			archive := newStore(t, "archive")
+			sc, err := NewSchniffCollection(store, archive)
+			if err != nil {
+				t.Fatalf("Failed to create schniff collection: %v", err)
+			}
+
+			schniffs := []*Schniff{
+				{SchniffID: "last-summer", UserID: "user1", CreationTime: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2023, 8, 31, 0, 0, 0, 0, time.UTC)},
+				{SchniffID: "last-night", UserID: "user1", CreationTime: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2023, 9, 30, 0, 0, 0, 0, time.UTC)},
+				{SchniffID: "tonight", UserID: "user1", CreationTime: time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)},
+				{SchniffID: "next-summer", UserID: "user1", CreationTime: time.Date(2023, 1, 4, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2024, 8, 31, 0, 0, 0, 0, time.UTC)},
+			}
+			for _, schniff := range schniffs {
+				err = sc.Add(schniff)
+				if err != nil {
+					t.Fatalf("Failed to add schniff: %v", err)
+				}
+			}
+
+			_, err = sc.Roll(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatalf("Failed to roll schniffs: %v", err)
+			}
+			archived, err := sc.ArchiveExpired()
+			if err != nil {
+				t.Fatalf("Failed to archive schniffs: %v", err)
+			}
+			if len(archived) != 2 {
+				t.Errorf("Expected 2 schniffs archived, got %d", len(archived))
+			}
+
+			// what's left survives a reload, and the archive has the rest most recent first
+			sc, err = NewSchniffCollection(store, archive)
+			if err != nil {
+				t.Fatalf("Failed to load schniffs: %v", err)
+			}
+			var remaining []string
+			for _, schniff := range sc.GetSchniffsForUser("user1") {
+				remaining = append(remaining, schniff.SchniffID)
+			}
+			if diff := cmp.Diff([]string{"tonight", "next-summer"}, remaining); diff != "" {
+				t.Errorf("Remaining schniffs mismatch (-want +got):\n%s", diff)
+			}
+
+			history, err := sc.GetArchivedSchniffsForUser("user1")
+			if err != nil {
+				t.Fatalf("Failed to get archived schniffs: %v", err)
+			}
+			var historyIDs []string
+			for _, schniff := range history {
+				historyIDs = append(historyIDs, schniff.SchniffID)
+			}
+			if diff := cmp.Diff([]string{"last-night", "last-summer"}, historyIDs); diff != "" {
+				t.Errorf("Archived schniffs mismatch (-want +got):\n%s", diff)
+			}
+
+			if _, err := sc.GetArchivedSchniff("last-night"); err != nil {
+				t.Errorf("Expected to find the archived schniff: %v", err)
+			}
+			if _, err := sc.GetArchivedSchniff("tonight"); err == nil {
+				t.Errorf("Expected a running schniff not to be in the archive")
+			}
+
+			// deleting gets rid of it wherever it is
+			for _, id := range []string{"tonight", "last-night"} {
+				err = sc.Delete(id)
+				if err != nil {
+					t.Fatalf("Failed to delete %s: %v", id, err)
+				}
+			}
+			if _, err := sc.GetSchniff("tonight"); err == nil {
+				t.Errorf("Expected deleted schniff to be gone")
+			}
+			sc, err = NewSchniffCollection(store, archive)
+			if err != nil {
+				t.Fatalf("Failed to load schniffs: %v", err)
+			}
+			if len(sc.schniffs) != 1 {
+				t.Errorf("Expected 1 schniff after deleting, got %d", len(sc.schniffs))
+			}
+			history, err = sc.GetArchivedSchniffsForUser("user1")
+			if err != nil {
+				t.Fatalf("Failed to get archived schniffs: %v", err)
+			}
+			if len(history) != 1 {
+				t.Errorf("Expected 1 archived schniff after deleting, got %d", len(history))
+			}
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// stateCodes packs each state into a single character so a month of a campsite is one short string
+var stateCodes = map[string]byte{
+	StateAvailable:      'A',
+	StateReserved:       'R',
+	StateNotReservable:  'N',
+	StateClosed:         'C',
+	StateNotYetReleased: 'Y',
+}
+
+const (
+	// stateCodeOther is any state we don't have a code for
+	stateCodeOther = '?'
+	// stateCodeMissing is a day the provider didn't tell us about
+	stateCodeMissing = '-'
+)
+
+func stateCode(state string) byte {
+	code, ok := stateCodes[state]
+	if !ok {
+		return stateCodeOther
+	}
+	return code
+}
+
+func stateFromCode(code byte) string {
+	for state, c := range stateCodes {
+		if c == code {
+			return state
+		}
+	}
+	if code == stateCodeMissing {
+		return ""
+	}
+	return "Other"
+}
+
+// Snapshot is the state of every campsite at a campground for a month, as seen at TakenAt. Each campsite has
+// one character per day of the month.
+type Snapshot struct {
+	Provider     string            `json:"provider"`
+	CampgroundID string            `json:"campground_id"`
+	Month        time.Time         `json:"month"`
+	TakenAt      time.Time         `json:"taken_at"`
+	Campsites    map[string]string `json:"campsites"`
+}
+
+// NewSnapshot packs the availability for the month into a snapshot. Dates outside the month are dropped.
+func NewSnapshot(availability AvailabilityWithID, month time.Time, takenAt time.Time) Snapshot {
+	month = GetStartOfMonth(month)
+	days := month.AddDate(0, 1, -1).Day()
+
+	snapshot := Snapshot{
+		Provider:     providerOrDefault(availability.Provider),
+		CampgroundID: availability.CampgroundID,
+		Month:        month,
+		TakenAt:      takenAt,
+		Campsites:    make(map[string]string, len(availability.Availability.Campsites)),
+	}
+
+	for campsiteID, campsite := range availability.Availability.Campsites {
+		states := []byte(strings.Repeat(string(rune(stateCodeMissing)), days))
+		for dateString, state := range campsite.Availabilities {
+			date, err := time.Parse(time.RFC3339, dateString)
+			if err != nil {
+				continue
+			}
+			if date.Year() != month.Year() || date.Month() != month.Month() {
+				continue
+			}
+			states[date.Day()-1] = stateCode(state)
+		}
+		snapshot.Campsites[campsiteID] = string(states)
+	}
+
+	return snapshot
+}
+
+func (s Snapshot) key() string {
+	return campgroundKey(s.Provider, s.CampgroundID) + "/" + s.Month.Format("2006-01")
+}
+
+// Transition is a campsite night changing state between two snapshots
+type Transition struct {
+	Provider     string    `json:"provider"`
+	CampgroundID string    `json:"campground_id"`
+	CampsiteID   string    `json:"campsite_id"`
+	Date         time.Time `json:"date"`
+	From         string    `json:"from"`
+	To           string    `json:"to"`
+	At           time.Time `json:"at"`
+}
+
+// Opened is whether the campsite night became available
+func (t Transition) Opened() bool {
+	return t.To == StateAvailable && t.From != StateAvailable
+}
+
+// DiffSnapshots finds every campsite night that changed state between before and after. Campsites and days
+// that weren't in both snapshots are skipped since we don't know what they were.
+func DiffSnapshots(before, after Snapshot) []Transition {
+	var transitions []Transition
+	for campsiteID, afterStates := range after.Campsites {
+		beforeStates, ok := before.Campsites[campsiteID]
+		if !ok || len(beforeStates) != len(afterStates) {
+			continue
+		}
+
+		for day := 0; day < len(afterStates); day++ {
+			if beforeStates[day] == afterStates[day] {
+				continue
+			}
+			if beforeStates[day] == stateCodeMissing || afterStates[day] == stateCodeMissing {
+				continue
+			}
+			transitions = append(transitions, Transition{
+				Provider:     after.Provider,
+				CampgroundID: after.CampgroundID,
+				CampsiteID:   campsiteID,
+				Date:         after.Month.AddDate(0, 0, day),
+				From:         stateFromCode(beforeStates[day]),
+				To:           stateFromCode(afterStates[day]),
+				At:           after.TakenAt,
+			})
+		}
+	}
+
+	return transitions
+}
+
+var (
+	snapshotBucket   = []byte("snapshots")
+	transitionBucket = []byte("transitions")
+)
+
+// SnapshotStore keeps the latest snapshot of every campground month, and the history of transitions
+// between them, in a bbolt database
+type SnapshotStore struct {
+	db *bolt.DB
+}
+
+func NewSnapshotStore(fileLocation string) (*SnapshotStore, error) {
+	err := os.MkdirAll(filepath.Dir(fileLocation), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(fileLocation, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(snapshotBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(transitionBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SnapshotStore{db: db}, nil
+}
+
+// Put stores the snapshot in place of the last one for its campground month and returns the transitions
+// since then. The first snapshot of a campground month has nothing to compare against so has no transitions.
+func (ss *SnapshotStore) Put(snapshot Snapshot) ([]Transition, error) {
+	var transitions []Transition
+	err := ss.db.Update(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(snapshotBucket)
+		key := []byte(snapshot.key())
+
+		previousData := snapshots.Get(key)
+		if previousData != nil {
+			var previous Snapshot
+			err := json.Unmarshal(previousData, &previous)
+			if err != nil {
+				return fmt.Errorf("couldn't unmarshal snapshot %s: %w", key, err)
+			}
+			transitions = DiffSnapshots(previous, snapshot)
+		}
+
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		err = snapshots.Put(key, data)
+		if err != nil {
+			return err
+		}
+
+		if len(transitions) == 0 {
+			return nil
+		}
+		history, err := tx.Bucket(transitionBucket).CreateBucketIfNotExists([]byte(campgroundKey(snapshot.Provider, snapshot.CampgroundID)))
+		if err != nil {
+			return err
+		}
+		for _, transition := range transitions {
+			data, err := json.Marshal(transition)
+			if err != nil {
+				return err
+			}
+			sequence, err := history.NextSequence()
+			if err != nil {
+				return err
+			}
+			err = history.Put(sequenceKey(sequence), data)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transitions, nil
+}
+
+// Latest gets the last snapshot of the campground month, if there is one
+func (ss *SnapshotStore) Latest(provider, campgroundID string, month time.Time) (Snapshot, bool, error) {
+	key := []byte(Snapshot{Provider: providerOrDefault(provider), CampgroundID: campgroundID, Month: GetStartOfMonth(month)}.key())
+
+	var snapshot Snapshot
+	var found bool
+	err := ss.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(snapshotBucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &snapshot)
+	})
+
+	return snapshot, found, err
+}
+
+// Transitions gets every transition we've seen at the campground, oldest first
+func (ss *SnapshotStore) Transitions(provider, campgroundID string) ([]Transition, error) {
+	var transitions []Transition
+	err := ss.db.View(func(tx *bolt.Tx) error {
+		history := tx.Bucket(transitionBucket).Bucket([]byte(campgroundKey(provider, campgroundID)))
+		if history == nil {
+			return nil
+		}
+		return history.ForEach(func(k, v []byte) error {
+			var transition Transition
+			err := json.Unmarshal(v, &transition)
+			if err != nil {
+				return fmt.Errorf("couldn't unmarshal transition %x: %w", k, err)
+			}
+			transitions = append(transitions, transition)
+			return nil
+		})
+	})
+
+	return transitions, err
+}
+
+// PruneTransitions drops every transition seen before cutoff and returns how many went. Each campground's
+// history is oldest first, so it's only read up to the first transition that's kept.
+func (ss *SnapshotStore) PruneTransitions(cutoff time.Time) (int, error) {
+	pruned := 0
+	err := ss.db.Update(func(tx *bolt.Tx) error {
+		transitions := tx.Bucket(transitionBucket)
+		var campgrounds [][]byte
+		err := transitions.ForEach(func(k, v []byte) error {
+			// campground histories are the nested buckets, which have no value
+			if v == nil {
+				campgrounds = append(campgrounds, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, campground := range campgrounds {
+			history := transitions.Bucket(campground)
+
+			// deleting while moving a cursor skips keys, so collect them first
+			var old [][]byte
+			cursor := history.Cursor()
+			for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+				var transition Transition
+				err := json.Unmarshal(v, &transition)
+				if err != nil {
+					return fmt.Errorf("couldn't unmarshal transition %x: %w", k, err)
+				}
+				if !transition.At.Before(cutoff) {
+					break
+				}
+				old = append(old, append([]byte(nil), k...))
+			}
+
+			for _, k := range old {
+				err := history.Delete(k)
+				if err != nil {
+					return err
+				}
+			}
+			pruned += len(old)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return pruned, nil
+}
+
+func (ss *SnapshotStore) Close() error {
+	return ss.db.Close()
+}
+
+// sequenceKey is big endian so keys sort in the order they were added
+func sequenceKey(sequence uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, sequence)
+	return key
+}
+
+// ChangeTracker snapshots every fetch and remembers which campsite nights opened up in the latest cycle, so
+// that people are told about changes rather than about everything that happens to be available.
+type ChangeTracker struct {
+	store *SnapshotStore
+
+	mu     sync.Mutex
+	opened map[string]struct{}
+	// primed holds the schniffs that have been checked against the whole state of their campground, and the
+	// version of each that was checked. Until then a schniff has never seen what's already open, so it gets
+	// told about that once. Editing a schniff changes what it wants, so it is primed again.
+	primed map[string]time.Time
+}
+
+// NewChangeTracker snapshots into store. A nil store doesn't snapshot anything, so nothing ever changes and
+// schniffs only hear about what's open when they're primed.
+func NewChangeTracker(store *SnapshotStore) *ChangeTracker {
+	return &ChangeTracker{
+		store:  store,
+		opened: make(map[string]struct{}),
+		primed: make(map[string]time.Time),
+	}
+}
+
+func openedKey(provider, campgroundID, campsiteID string, date time.Time) string {
+	return campgroundKey(provider, campgroundID) + "/" + campsiteID + "/" + date.Format("2006-01-02")
+}
+
+// Update snapshots the successful results and returns the transitions since the last time each was fetched.
+// The campsite nights that opened replace the ones from the last cycle. A result without any campsites is
+// skipped rather than stored, since the snapshot after it would have nothing to compare against and every
+// cancellation in it would be missed.
+func (ct *ChangeTracker) Update(results []AvailabilityResult, now time.Time) ([]Transition, error) {
+	var transitions []Transition
+	var errs []string
+	for _, result := range results {
+		if result.Err != nil || ct.store == nil {
+			continue
+		}
+		if len(result.Availability.Availability.Campsites) == 0 {
+			continue
+		}
+		snapshot := NewSnapshot(result.Availability, result.Request.TargetTime, now)
+		snapshotTransitions, err := ct.store.Put(snapshot)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", snapshot.key(), err))
+			continue
+		}
+		transitions = append(transitions, snapshotTransitions...)
+	}
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ct.opened = make(map[string]struct{})
+	for _, transition := range transitions {
+		if !transition.Opened() {
+			continue
+		}
+		ct.opened[openedKey(transition.Provider, transition.CampgroundID, transition.CampsiteID, transition.Date)] = struct{}{}
+	}
+
+	if len(errs) > 0 {
+		return transitions, fmt.Errorf("couldn't store snapshots: %s", strings.Join(errs, ", "))
+	}
+	return transitions, nil
+}
+
+// Opened is whether the campsite night became available in the latest cycle
+func (ct *ChangeTracker) Opened(provider, campgroundID, campsiteID string, date time.Time) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	_, ok := ct.opened[openedKey(providerOrDefault(provider), campgroundID, campsiteID, date)]
+	return ok
+}
+
+// Primed is whether this version of the schniff has already been checked against everything that's open
+func (ct *ChangeTracker) Primed(schniff *Schniff) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	updated, ok := ct.primed[schniff.SchniffID]
+	return ok && updated.Equal(schniff.UpdatedTime)
+}
+
+// Prime marks this version of the schniff as having been checked against everything that's open
+func (ct *ChangeTracker) Prime(schniff *Schniff) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ct.primed[schniff.SchniffID] = schniff.UpdatedTime
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	availability := AvailabilityWithID{
+		CampgroundID: "camp1",
+		Availability: Availability{Campsites: map[string]Campsite{
+			"site1": {Availabilities: map[string]string{
+				"2023-02-01T00:00:00Z": StateAvailable,
+				"2023-02-02T00:00:00Z": StateReserved,
+				"2023-02-03T00:00:00Z": StateNotReservable,
+				"2023-02-04T00:00:00Z": StateClosed,
+				"2023-02-05T00:00:00Z": StateNotYetReleased,
+				"2023-02-06T00:00:00Z": "Lottery",
+				// outside the month
+				"2023-03-01T00:00:00Z": StateAvailable,
+			}},
+		}},
+	}
+
+	snapshot := NewSnapshot(availability, time.Date(2023, 2, 14, 0, 0, 0, 0, time.UTC), time.Time{})
+
+	expected := map[string]string{
+		"site1": "ARNCY?----------------------",
+	}
+	if diff := cmp.Diff(expected, snapshot.Campsites); diff != "" {
+		t.Errorf("Snapshot mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	month := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	takenAt := time.Date(2023, 1, 20, 8, 0, 0, 0, time.UTC)
+	before := Snapshot{Provider: ProviderRecreationGov, CampgroundID: "camp1", Month: month, Campsites: map[string]string{
+		"site1": "RRNY",
+		"site2": "AAAA",
+		"gone":  "AAAA",
+	}}
+	after := Snapshot{Provider: ProviderRecreationGov, CampgroundID: "camp1", Month: month, TakenAt: takenAt, Campsites: map[string]string{
+		"site1": "ARAA",
+		"site2": "AR-A",
+		"new":   "AAAA",
+	}}
+
+	transitions := DiffSnapshots(before, after)
+
+	expected := map[string]Transition{
+		"site1/0": {CampsiteID: "site1", Date: month, From: StateReserved, To: StateAvailable},
+		"site1/2": {CampsiteID: "site1", Date: month.AddDate(0, 0, 2), From: StateNotReservable, To: StateAvailable},
+		"site1/3": {CampsiteID: "site1", Date: month.AddDate(0, 0, 3), From: StateNotYetReleased, To: StateAvailable},
+		"site2/1": {CampsiteID: "site2", Date: month.AddDate(0, 0, 1), From: StateAvailable, To: StateReserved},
+	}
+	got := make(map[string]Transition)
+	for _, transition := range transitions {
+		if transition.Provider != ProviderRecreationGov || transition.CampgroundID != "camp1" || !transition.At.Equal(takenAt) {
+			t.Errorf("Transition is missing where or when it happened: %+v", transition)
+		}
+		transition.Provider, transition.CampgroundID, transition.At = "", "", time.Time{}
+		got[fmt.Sprintf("%s/%d", transition.CampsiteID, transition.Date.Day()-1)] = transition
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Transitions mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestChangeTrackerDrivesNotifications(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	store, err := NewSnapshotStore(filepath.Join(t.TempDir(), "snapshots.db"))
+	if err != nil {
+		t.Fatalf("Failed to open snapshot store: %v", err)
+	}
+	defer store.Close()
+	ct := NewChangeTracker(store)
+
+	sc := newTestSchniffCollection(t,
+		&Schniff{SchniffID: "schniff1", CampgroundID: "camp1", StartDate: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2023, 8, 31, 0, 0, 0, 0, time.UTC), Active: true},
+	)
+	rs, err := NewNotificationRecordStore("", RecordRetention{})
+	if err != nil {
+		t.Fatalf("Failed to create notification record store: %v", err)
+	}
+
+	request := AvailabilityRequest{Provider: ProviderRecreationGov, CampgroundID: "camp1", TargetTime: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)}
+	cycle := func(now time.Time, states map[string]string) ([]Transition, []Notification) {
+		t.Helper()
+		result := AvailabilityResult{Request: request, Availability: AvailabilityWithID{CampgroundID: "camp1", Availability: Availability{Campsites: map[string]Campsite{
+			"site1": {Availabilities: states},
+		}}}}
+		transitions, err := ct.Update([]AvailabilityResult{result}, now)
+		if err != nil {
+			t.Fatalf("Failed to update change tracker: %v", err)
+		}
+		notifications, records, err := GenerateNotifications(ctx, logger, []AvailabilityWithID{result.Availability}, sc, rs, ct)
+		if err != nil {
+			t.Fatalf("Failed to generate notifications: %v", err)
+		}
+		err = rs.Add(records...)
+		if err != nil {
+			t.Fatalf("Failed to add records: %v", err)
+		}
+		return transitions, notifications
+	}
+
+	now := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	// a new schniff hears about what's already open
+	_, notifications := cycle(now, map[string]string{
+		"2023-08-01T00:00:00Z": StateAvailable,
+		"2023-08-02T00:00:00Z": StateReserved,
+		"2023-08-03T00:00:00Z": StateReserved,
+	})
+	if len(notifications) != 1 {
+		t.Fatalf("Expected the new schniff to be told what's open, got %d notifications", len(notifications))
+	}
+
+	// nothing changed, nothing to say
+	_, notifications = cycle(now.Add(time.Minute), map[string]string{
+		"2023-08-01T00:00:00Z": StateAvailable,
+		"2023-08-02T00:00:00Z": StateReserved,
+		"2023-08-03T00:00:00Z": StateReserved,
+	})
+	if len(notifications) != 0 {
+		t.Fatalf("Expected no notifications without changes, got %d", len(notifications))
+	}
+
+	// a cancellation is a transition and gets notified
+	transitions, notifications := cycle(now.Add(2*time.Minute), map[string]string{
+		"2023-08-01T00:00:00Z": StateAvailable,
+		"2023-08-02T00:00:00Z": StateReserved,
+		"2023-08-03T00:00:00Z": StateAvailable,
+	})
+	if len(transitions) != 1 || !transitions[0].Opened() || transitions[0].From != StateReserved {
+		t.Errorf("Expected one reserved to available transition, got %+v", transitions)
+	}
+	expected := []Notification{
+		{SchniffID: "schniff1", AvailableCampsites: []CampsiteAvailability{{CampsiteID: "site1", Date: time.Date(2023, 8, 3, 0, 0, 0, 0, time.UTC)}}},
+	}
+	if diff := cmp.Diff(expected, notifications); diff != "" {
+		t.Errorf("Notifications mismatch (-want +got):\n%s", diff)
+	}
+
+	// someone books it, then cancels again. that's worth hearing about twice.
+	transitions, _ = cycle(now.Add(3*time.Minute), map[string]string{
+		"2023-08-01T00:00:00Z": StateAvailable,
+		"2023-08-02T00:00:00Z": StateReserved,
+		"2023-08-03T00:00:00Z": StateReserved,
+	})
+	_, err = rs.Clear(transitions)
+	if err != nil {
+		t.Fatalf("Failed to clear records: %v", err)
+	}
+	_, notifications = cycle(now.Add(4*time.Minute), map[string]string{
+		"2023-08-01T00:00:00Z": StateAvailable,
+		"2023-08-02T00:00:00Z": StateReserved,
+		"2023-08-03T00:00:00Z": StateAvailable,
+	})
+	if diff := cmp.Diff(expected, notifications); diff != "" {
+		t.Errorf("Notifications mismatch after the site came back (-want +got):\n%s", diff)
+	}
+
+	// editing the schniff changes what it wants, so it hears about what's already open that it hasn't been told
+	schniff, err := sc.GetSchniff("schniff1")
+	if err != nil {
+		t.Fatalf("Failed to get schniff: %v", err)
+	}
+	edited := *schniff
+	edited.MinimumConsecutiveDays = 1
+	edited.UpdatedTime = now.Add(5 * time.Minute)
+	err = sc.Update(&edited)
+	if err != nil {
+		t.Fatalf("Failed to update schniff: %v", err)
+	}
+	if ct.Primed(schniff) {
+		t.Errorf("Expected an edited schniff to need priming again")
+	}
+
+	history, err := store.Transitions(ProviderRecreationGov, "camp1")
+	if err != nil {
+		t.Fatalf("Failed to get transitions: %v", err)
+	}
+	if len(history) != 3 {
+		t.Errorf("Expected 3 transitions in the history, got %d", len(history))
+	}
+}
+
+func TestChangeTrackerSkipsEmptyResults(t *testing.T) {
+	store, err := NewSnapshotStore(filepath.Join(t.TempDir(), "snapshots.db"))
+	if err != nil {
+		t.Fatalf("Failed to open snapshot store: %v", err)
+	}
+	defer store.Close()
+	ct := NewChangeTracker(store)
+
+	now := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	request := AvailabilityRequest{Provider: ProviderRecreationGov, CampgroundID: "camp1", TargetTime: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)}
+	update := func(now time.Time, campsites map[string]Campsite) []Transition {
+		t.Helper()
+		result := AvailabilityResult{Request: request, Availability: AvailabilityWithID{CampgroundID: "camp1", Availability: Availability{Campsites: campsites}}}
+		transitions, err := ct.Update([]AvailabilityResult{result}, now)
+		if err != nil {
+			t.Fatalf("Failed to update change tracker: %v", err)
+		}
+		return transitions
+	}
+
+	update(now, map[string]Campsite{"site1": {Availabilities: map[string]string{"2023-08-01T00:00:00Z": StateReserved}}})
+	// a fetch that came back empty doesn't replace what we knew
+	update(now.Add(time.Minute), nil)
+	transitions := update(now.Add(2*time.Minute), map[string]Campsite{"site1": {Availabilities: map[string]string{"2023-08-01T00:00:00Z": StateAvailable}}})
+	if len(transitions) != 1 || !transitions[0].Opened() {
+		t.Errorf("Expected the cancellation after an empty fetch, got %+v", transitions)
+	}
+}
+
+func TestPruneTransitions(t *testing.T) {
+	store, err := NewSnapshotStore(filepath.Join(t.TempDir(), "snapshots.db"))
+	if err != nil {
+		t.Fatalf("Failed to open snapshot store: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	month := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	states := []string{"R", "A", "R", "A"}
+	for i, state := range states {
+		_, err := store.Put(Snapshot{Provider: ProviderRecreationGov, CampgroundID: "camp1", Month: month, TakenAt: now.Add(time.Duration(i) * time.Hour), Campsites: map[string]string{"site1": state}})
+		if err != nil {
+			t.Fatalf("Failed to put snapshot: %v", err)
+		}
+	}
+
+	// the transitions were seen at 1h, 2h and 3h
+	pruned, err := store.PruneTransitions(now.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to prune transitions: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("Expected 1 transition pruned, got %d", pruned)
+	}
+
+	history, err := store.Transitions(ProviderRecreationGov, "camp1")
+	if err != nil {
+		t.Fatalf("Failed to get transitions: %v", err)
+	}
+	if len(history) != 2 || !history[0].At.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("Expected the 2 newest transitions to be kept, got %+v", history)
+	}
+}
@@ -17,7 +17,16 @@ type tracker struct {
 	ActiveUsers       map[string]struct{}
 	ActiveDays        map[time.Time]struct{}
 	ActiveCampgrounds map[string]struct{}
-	mu                sync.Mutex
+
+	// queue depth is how many requests are still waiting, sampled every time a worker picks one up
+	MaxQueueDepth      int
+	queueDepthTotal    int
+	queueDepthSamples  int
+	MaxCycleDuration   time.Duration
+	totalCycleDuration time.Duration
+	Cycles             int
+
+	mu sync.Mutex
 }
 
 func NewTracker() *tracker {
@@ -76,6 +85,28 @@ func (t *tracker) AddActiveCampground(campgroundID string) {
 	t.ActiveCampgrounds[campgroundID] = struct{}{}
 }
 
+func (t *tracker) RecordQueueDepth(depth int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if depth > t.MaxQueueDepth {
+		t.MaxQueueDepth = depth
+	}
+	t.queueDepthTotal += depth
+	t.queueDepthSamples++
+}
+
+func (t *tracker) RecordCycle(duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if duration > t.MaxCycleDuration {
+		t.MaxCycleDuration = duration
+	}
+	t.totalCycleDuration += duration
+	t.Cycles++
+}
+
 func (t *tracker) Reset() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -87,6 +118,12 @@ func (t *tracker) Reset() {
 	t.ActiveUsers = make(map[string]struct{})
 	t.ActiveDays = make(map[time.Time]struct{})
 	t.ActiveCampgrounds = make(map[string]struct{})
+	t.MaxQueueDepth = 0
+	t.queueDepthTotal = 0
+	t.queueDepthSamples = 0
+	t.MaxCycleDuration = 0
+	t.totalCycleDuration = 0
+	t.Cycles = 0
 
 }
 
@@ -136,6 +173,15 @@ func (t *tracker) CreateEmbedSummary(sc *SchniffCollection) *discordgo.MessageEm
 	elapsed := time.Since(t.LastReset).Hours()
 	requestsPerHour := float64(totalRequests) / elapsed
 
+	averageQueueDepth := 0.0
+	if t.queueDepthSamples > 0 {
+		averageQueueDepth = float64(t.queueDepthTotal) / float64(t.queueDepthSamples)
+	}
+	var averageCycleDuration time.Duration
+	if t.Cycles > 0 {
+		averageCycleDuration = t.totalCycleDuration / time.Duration(t.Cycles)
+	}
+
 	return &discordgo.MessageEmbed{
 		Title: "Schniffer summary:\nLast " + fmt.Sprintf("%.2f", elapsed) + " hours",
 		Fields: []*discordgo.MessageEmbedField{
@@ -154,6 +200,16 @@ func (t *tracker) CreateEmbedSummary(sc *SchniffCollection) *discordgo.MessageEm
 				Value:  fmt.Sprintf("%.2f", requestsPerHour),
 				Inline: true,
 			},
+			{
+				Name:   "Queue depth (avg/max)",
+				Value:  fmt.Sprintf("%.2f / %d", averageQueueDepth, t.MaxQueueDepth),
+				Inline: true,
+			},
+			{
+				Name:   "Cycle time (avg/max)",
+				Value:  fmt.Sprintf("%s / %s", averageCycleDuration.Round(time.Millisecond), t.MaxCycleDuration.Round(time.Millisecond)),
+				Inline: true,
+			},
 			{
 				Name:   "Active Schniffs",
 				Value:  fmt.Sprintf("%d", len(t.ActiveSchniffs)),